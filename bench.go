@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"go-kusto-test/kustoclient"
+)
+
+// benchClusters runs the ingestion benchmark against each of the clusters in turn, writing a
+// summary line for each to w: the fastest, slowest and mean iteration, and the rows ingested
+// per second by the mean one. timeout is the time limit for authenticating, and the whole
+// benchmark against a cluster is limited to timeout times iterations. It returns an error if
+// the benchmark failed against any cluster.
+func benchClusters(ctx context.Context, w io.Writer, cfg kustoclient.Config, clusters []string, timeout time.Duration, rows, iterations int) error {
+	failed := 0
+	for _, cluster := range clusters {
+		clusterCfg := cfg
+		clusterCfg.ClusterURL = cluster
+
+		result, err := benchCluster(ctx, clusterCfg, timeout, rows, iterations)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %v\n", cluster, err)
+			continue
+		}
+
+		fmt.Fprintf(w, "OK   %s %d rows x %d iterations: min %s, max %s, mean %s, %.0f rows/s\n", cluster, result.Rows, len(result.Durations),
+			result.Min().Round(time.Millisecond), result.Max().Round(time.Millisecond), result.Mean().Round(time.Millisecond), result.RowsPerSecond())
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d clusters failed the benchmark", failed, len(clusters))
+	}
+
+	return nil
+}
+
+// benchCluster connects to the cluster in cfg and runs the benchmark against it.
+func benchCluster(ctx context.Context, cfg kustoclient.Config, timeout time.Duration, rows, iterations int) (kustoclient.BenchResult, error) {
+	var kusto *kustoclient.Client
+	err := withTimeout(ctx, timeout, "authentication", func(ctx context.Context) error {
+		var err error
+		kusto, err = kustoclient.NewClient(ctx, cfg)
+		return err
+	})
+	if err != nil {
+		return kustoclient.BenchResult{}, err
+	}
+	defer kusto.Close()
+
+	var result kustoclient.BenchResult
+	err = withTimeout(ctx, timeout*time.Duration(iterations), "benchmark", func(ctx context.Context) error {
+		var err error
+		result, err = kustoclient.Bench(ctx, kusto, cfg, rows, iterations)
+		return err
+	})
+
+	return result, err
+}
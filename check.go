@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+
+	"go-kusto-test/kustoclient"
+)
+
+// checkClusters checks that each of the clusters can be authenticated to and queried,
+// writing an OK or FAIL line for each to w. With ping, the check runs a print query rather
+// than a management command, and the line has what it printed. It returns an error if any
+// check failed.
+func checkClusters(ctx context.Context, w io.Writer, cfg kustoclient.Config, clusters []string, timeout time.Duration, ping bool) error {
+	failed := 0
+	for _, cluster := range clusters {
+		clusterCfg := cfg
+		clusterCfg.ClusterURL = cluster
+
+		start := time.Now()
+		roundTrip, printed, err := checkCluster(ctx, clusterCfg, timeout, ping)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s after %s: %v\n", cluster, time.Since(start).Round(time.Millisecond), err)
+			continue
+		}
+
+		fmt.Fprintf(w, "OK   %s round trip %s (%s including authentication)%s\n", cluster, roundTrip.Round(time.Millisecond), time.Since(start).Round(time.Millisecond), printed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d clusters failed the check", failed, len(clusters))
+	}
+
+	return nil
+}
+
+// checkCluster authenticates to the cluster in cfg and runs a command, or with ping a print
+// query, against it, returning the round trip time and, for a ping, what the query printed.
+func checkCluster(ctx context.Context, cfg kustoclient.Config, timeout time.Duration, ping bool) (time.Duration, string, error) {
+	var kcsb *azkustodata.ConnectionStringBuilder
+	err := withTimeout(ctx, timeout, "authentication", func(ctx context.Context) error {
+		var err error
+		kcsb, err = kustoclient.Connect(ctx, cfg)
+		return err
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	client, err := kustoclient.NewQueryClient(kcsb, cfg)
+	if err != nil {
+		return 0, "", err
+	}
+	defer client.Close()
+
+	if ping {
+		var result kustoclient.PingResult
+		err = withTimeout(ctx, timeout, "ping", func(ctx context.Context) error {
+			var err error
+			result, err = kustoclient.Ping(ctx, client, cfg)
+			return err
+		})
+
+		return result.RoundTrip, fmt.Sprintf(": now() = %s, %s", result.ServerTime.UTC().Format(time.RFC3339Nano), result.Status), err
+	}
+
+	var roundTrip time.Duration
+	err = withTimeout(ctx, timeout, "check", func(ctx context.Context) error {
+		var err error
+		roundTrip, err = kustoclient.Check(ctx, client, cfg)
+		return err
+	})
+
+	return roundTrip, "", err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-kusto-test/kustoclient"
+)
+
+// parseClusters splits a comma-separated list of cluster URLs, dropping empty entries,
+// and checks that no cluster is listed twice.
+func parseClusters(list string) ([]string, error) {
+	var clusters []string
+	seen := map[string]bool{}
+	for _, cluster := range strings.Split(list, ",") {
+		cluster = strings.TrimSpace(cluster)
+		if cluster == "" {
+			continue
+		}
+
+		if seen[cluster] {
+			return nil, fmt.Errorf("invalid -clusters: cluster %q is listed more than once", cluster)
+		}
+		seen[cluster] = true
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, nil
+}
+
+// runClusters runs the pipeline against each of the clusters in turn, carrying on past
+// failures. It logs which clusters succeeded and which failed, and returns an error
+// joining the failures if there were any.
+func runClusters(ctx context.Context, p pipeline, cfg kustoclient.Config, clusters []string) error {
+	var succeeded, failed []string
+	var errs []error
+	for _, cluster := range clusters {
+		if ctx.Err() != nil {
+			// Don't start on the remaining clusters once the run is cancelled.
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster, ctx.Err()))
+			failed = append(failed, cluster)
+			continue
+		}
+
+		clusterCfg := cfg
+		clusterCfg.ClusterURL = cluster
+		if err := p.run(ctx, clusterCfg); err != nil {
+			logger.Error("Cluster failed", "cluster", cluster, "error", err)
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster, err))
+			failed = append(failed, cluster)
+			continue
+		}
+
+		logger.Info("Cluster succeeded", "cluster", cluster)
+		succeeded = append(succeeded, cluster)
+	}
+
+	logger.Info("Done.", "succeeded", succeeded, "failed", failed)
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d clusters failed: %w", len(errs), len(clusters), errors.Join(errs...))
+	}
+
+	return nil
+}
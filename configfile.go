@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"go-kusto-test/kustoclient"
+)
+
+// fileConfig is the contents of a -config file. Fields left out of the file are left empty.
+type fileConfig struct {
+	Cluster  string   `json:"cluster" yaml:"cluster"`
+	Clusters []string `json:"clusters" yaml:"clusters"`
+	Database string   `json:"database" yaml:"database"`
+	Table    string   `json:"table" yaml:"table"`
+	Auth     string   `json:"auth" yaml:"auth"`
+	Format   string   `json:"format" yaml:"format"`
+	Mapping  string   `json:"mapping" yaml:"mapping"`
+}
+
+// loadConfigFile reads the YAML or JSON config file at path, going by its extension
+// (.json for JSON, anything else for YAML). Unknown fields are rejected, so that a
+// misspelt field doesn't silently fall back to its default.
+func loadConfigFile(path string) (fileConfig, error) {
+	var fc fileConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fc, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fc)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&fc)
+		if errors.Is(err, io.EOF) {
+			// An empty YAML file sets nothing.
+			err = nil
+		}
+	}
+	if err != nil {
+		return fc, fmt.Errorf("error parsing config file %q: %w", path, err)
+	}
+
+	if fc.Cluster != "" && len(fc.Clusters) > 0 {
+		return fc, fmt.Errorf("invalid config file %q: only one of \"cluster\" and \"clusters\" can be set", path)
+	}
+
+	if fc.Auth != "" {
+		if _, err := kustoclient.ParseAuthType(fc.Auth); err != nil {
+			return fc, fmt.Errorf("invalid config file %q: field \"auth\": %w", path, err)
+		}
+	}
+
+	return fc, nil
+}
+
+// fileValue pairs a flag's value with the value the config file sets for it.
+type fileValue struct {
+	flag *string
+	file string
+}
+
+// applyConfigFile sets each named flag to its value from the config file,
+// unless the flag was given on the command line or the file leaves it empty.
+func applyConfigFile(values map[string]fileValue) {
+	for name, v := range values {
+		if !isFlagSet(name) && v.file != "" {
+			*v.flag = v.file
+		}
+	}
+}
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	for _, fs := range cmdFlags {
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == name {
+				set = true
+			}
+		})
+	}
+
+	return set
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// isTerminal reports whether f is an interactive terminal rather than a pipe or a file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmIngestion asks on out whether to ingest into the table in each of the clusters,
+// and reads the answer from in. Anything but y or yes declines.
+func confirmIngestion(in io.Reader, out io.Writer, clusters []string, database, table string) (bool, error) {
+	fmt.Fprintln(out, "About to ingest into:")
+	for _, cluster := range clusters {
+		fmt.Fprintf(out, "  cluster:  %s\n", cluster)
+	}
+	fmt.Fprintf(out, "  database: %s\n  table:    %s\n", database, table)
+	fmt.Fprint(out, "Continue? [y/N] ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("error reading confirmation: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
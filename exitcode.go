@@ -0,0 +1,62 @@
+package main
+
+import "errors"
+
+// Exit codes, telling schedulers which part of a run failed.
+const (
+	exitOK      = 0
+	exitFailure = 1 // any other failure
+	exitAuth    = 2
+	exitIngest  = 3
+	exitQuery   = 4
+	exitConfig  = 5
+)
+
+// exitCodesHelp documents the exit codes in the usage message.
+const exitCodesHelp = `
+Exit codes:
+  0  success
+  1  other failure
+  2  authentication failed, or check failed to reach a cluster
+  3  ingestion failed, including creating or checking the table and verifying the ingestion
+  4  querying back or running -command failed
+  5  invalid flags or config
+`
+
+// codedError is an error carrying the exit code the process should end with.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns err carrying the exit code code, unless it already carries one.
+func withExitCode(code int, err error) error {
+	var coded *codedError
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+
+	return &codedError{code: code, err: err}
+}
+
+// exitCode returns the exit code the process should end with after err.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	return exitFailure
+}
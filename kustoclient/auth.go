@@ -0,0 +1,654 @@
+package kustoclient
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AuthType is the authentication mechanism to use when
+// interacting with the Kusto cluster.
+type AuthType int
+
+const (
+	BearerToken          AuthType = iota // Use a user's bearer token (will prompt for login with a device code)
+	Interactive                          // Uses your existing az login credentials (or prompts for login if needed)
+	ServicePrincipal                     // Uses an AAD application's client ID and secret (non-interactive)
+	ManagedIdentity                      // Uses the Azure managed identity of the hosting VM, App Service or AKS pod
+	ServicePrincipalCert                 // Uses an AAD application's client ID and certificate (non-interactive)
+	AzureCLI                             // Reuses the account you are logged into with az login
+	InteractiveBrowser                   // Opens the system browser to log in
+	WorkloadIdentity                     // Exchanges the federated token of an AKS workload identity (non-interactive)
+	StaticToken                          // Uses a token acquired beforehand, as injected by a CI system (non-interactive)
+)
+
+// String returns the string representation of the AuthType.
+func (a AuthType) String() string {
+	switch a {
+	case BearerToken:
+		return "BearerToken"
+	case Interactive:
+		return "Interactive"
+	case ServicePrincipal:
+		return "ServicePrincipal"
+	case ManagedIdentity:
+		return "ManagedIdentity"
+	case ServicePrincipalCert:
+		return "ServicePrincipalCert"
+	case AzureCLI:
+		return "AzureCLI"
+	case InteractiveBrowser:
+		return "InteractiveBrowser"
+	case WorkloadIdentity:
+		return "WorkloadIdentity"
+	case StaticToken:
+		return "StaticToken"
+	default:
+		return "Unknown"
+	}
+}
+
+// Description returns a short description of how the AuthType authenticates.
+func (a AuthType) Description() string {
+	switch a {
+	case BearerToken:
+		return "log in with a device code"
+	case Interactive:
+		return "reuse your az login credentials, or prompt to log in"
+	case ServicePrincipal:
+		return "an AAD application's client ID and secret"
+	case ManagedIdentity:
+		return "the managed identity of the hosting VM, App Service or AKS pod"
+	case ServicePrincipalCert:
+		return "an AAD application's client ID and certificate"
+	case AzureCLI:
+		return "the account you are logged into with az login"
+	case InteractiveBrowser:
+		return "log in through the system browser"
+	case WorkloadIdentity:
+		return "the federated token of an AKS workload identity"
+	case StaticToken:
+		return "a token acquired beforehand, read from -token or KUSTO_TOKEN"
+	default:
+		return ""
+	}
+}
+
+// Alias returns the short name ParseAuthType accepts for the AuthType, or "" if it has none.
+func (a AuthType) Alias() string {
+	for _, alias := range authTypeAliases {
+		if alias.authType == a {
+			return alias.alias
+		}
+	}
+
+	return ""
+}
+
+// AuthTypes returns every supported AuthType.
+func AuthTypes() []AuthType {
+	return []AuthType{BearerToken, Interactive, ServicePrincipal, ManagedIdentity, ServicePrincipalCert, AzureCLI, InteractiveBrowser, WorkloadIdentity, StaticToken}
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the AuthType in its String form
+// so that it reads as its name in JSON and YAML.
+func (a AuthType) MarshalText() ([]byte, error) {
+	if a.String() == "Unknown" {
+		return nil, fmt.Errorf("invalid auth type: %d", int(a))
+	}
+
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting any name ParseAuthType does.
+func (a *AuthType) UnmarshalText(text []byte) error {
+	parsed, err := ParseAuthType(string(text))
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+	return nil
+}
+
+// authTypeAliases are the short names ParseAuthType accepts besides the String form.
+var authTypeAliases = []struct {
+	alias    string
+	authType AuthType
+}{
+	{"bearer", BearerToken},
+	{"sp", ServicePrincipal},
+	{"msi", ManagedIdentity},
+	{"sp-cert", ServicePrincipalCert},
+	{"cli", AzureCLI},
+	{"browser", InteractiveBrowser},
+	{"workload", WorkloadIdentity},
+	{"token", StaticToken},
+}
+
+// ParseAuthType maps the string representation of an AuthType, or its short name
+// (bearer, sp, msi, sp-cert, cli, browser, workload or token), back to it, ignoring case.
+func ParseAuthType(name string) (AuthType, error) {
+	authTypes := AuthTypes()
+	for _, a := range authTypes {
+		if strings.EqualFold(name, a.String()) {
+			return a, nil
+		}
+	}
+
+	for _, a := range authTypeAliases {
+		if strings.EqualFold(name, a.alias) {
+			return a.authType, nil
+		}
+	}
+
+	names := make([]string, len(authTypes))
+	for i, a := range authTypes {
+		names[i] = a.String()
+	}
+	aliases := make([]string, len(authTypeAliases))
+	for i, a := range authTypeAliases {
+		aliases[i] = a.alias
+	}
+
+	return BearerToken, fmt.Errorf("unsupported auth type %q, supported auth types are: %s (or %s)", name, strings.Join(names, ", "), strings.Join(aliases, ", "))
+}
+
+// Connect gets a connection string for the configured Kusto cluster using the configured auth type.
+// Requests made with it identify themselves with cfg.AppName and cfg.AppVersion, if set.
+func Connect(ctx context.Context, cfg Config) (_ *azkustodata.ConnectionStringBuilder, err error) {
+	ctx, span := startSpan(ctx, "Connect", cfg)
+	span.SetAttributes(attribute.String("kusto.auth_type", cfg.AuthType.String()))
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrAuth, err)
+	}()
+
+	kcsb, err := connectionString(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if app := applicationForTracing(cfg); app != "" {
+		kcsb.ApplicationForTracing = app
+	}
+
+	return kcsb, nil
+}
+
+// applicationForTracing returns the application name, and version if set, that .show queries
+// and .show commands list requests under: cfg.AppName or cfg.AppName/cfg.AppVersion. It is
+// empty without an AppName, leaving the SDK to use the executable's name.
+func applicationForTracing(cfg Config) string {
+	if cfg.AppName == "" {
+		return ""
+	}
+
+	if cfg.AppVersion == "" {
+		return cfg.AppName
+	}
+
+	return cfg.AppName + "/" + cfg.AppVersion
+}
+
+// connectionString builds the connection string Connect returns for the configured auth type.
+func connectionString(ctx context.Context, cfg Config) (*azkustodata.ConnectionStringBuilder, error) {
+	kustoURL := cfg.ClusterURL
+	tokenOpts := tokenRequestOptions(kustoURL, cfg.Scopes)
+
+	// The token scope is derived from the cluster URL, which is already in the right cloud.
+	clientOpts, err := cfg.Cloud.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := httpClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		clientOpts.Transport = httpClient
+	}
+
+	switch cfg.AuthType {
+	case BearerToken:
+		// Once the token expires, a new one is got from the cache or silently from the
+		// signed in account, only prompting again if that fails.
+		cred, err := newRefreshingCredential(ctx, func(ctx context.Context) (azcore.AccessToken, error) {
+			token, err := getAzBearerToken(ctx, tokenCacheKey(kustoURL, cfg.Scopes), tokenOpts, clientOpts, !cfg.NoTokenCache)
+			if err != nil {
+				return azcore.AccessToken{}, err
+			}
+			return *token, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithTokenCredential(cred), nil
+	case Interactive:
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithDefaultAzureCredential().AttachPolicyClientOptions(&clientOpts), nil
+	case ServicePrincipal:
+		clientID, tenantID, clientSecret, err := getServicePrincipalEnv()
+		if err != nil {
+			return nil, err
+		}
+
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithAadAppKey(clientID, clientSecret, tenantID).AttachPolicyClientOptions(&clientOpts), nil
+	case ManagedIdentity:
+		cred, err := getManagedIdentityCredential(ctx, tokenOpts, clientOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithTokenCredential(cred), nil
+	case ServicePrincipalCert:
+		clientID, tenantID, certPEM, password, err := getServicePrincipalCertEnv()
+		if err != nil {
+			return nil, err
+		}
+
+		// The builder takes the certificate password in its thumbprint argument.
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithAppCertificate(clientID, certPEM, password, false, tenantID).AttachPolicyClientOptions(&clientOpts), nil
+	case AzureCLI:
+		cred, err := getAzureCLICredential(ctx, tokenOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithTokenCredential(cred), nil
+	case InteractiveBrowser:
+		cred, err := getInteractiveBrowserCredential(ctx, tokenOpts, clientOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithTokenCredential(cred), nil
+	case WorkloadIdentity:
+		cred, err := getWorkloadIdentityCredential(clientOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithTokenCredential(cred), nil
+	case StaticToken:
+		// The token is read again once it expires, in case it has been replaced.
+		cred, err := newRefreshingCredential(ctx, func(ctx context.Context) (azcore.AccessToken, error) {
+			return staticAccessToken(cfg.TokenFile, time.Now())
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return azkustodata.NewConnectionStringBuilder(kustoURL).WithTokenCredential(cred), nil
+	default:
+		return nil, fmt.Errorf("invalid auth type: " + fmt.Sprint(cfg.AuthType))
+	}
+}
+
+// getStaticToken reads the token for StaticToken auth from tokenFile or, when that is empty,
+// the KUSTO_TOKEN environment variable. The token can't be refreshed, so a warning is logged
+// if its JWT exp claim says it has expired by now, before requests fail with it.
+func getStaticToken(tokenFile string, now time.Time) (string, error) {
+	var token string
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("token file %q does not exist", tokenFile)
+			}
+			return "", fmt.Errorf("error reading token file %q: %w", tokenFile, err)
+		}
+		token = strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %q is empty", tokenFile)
+		}
+	} else {
+		values, err := requireEnv("static token", "KUSTO_TOKEN")
+		if err != nil {
+			return "", fmt.Errorf("%w, or pass a token file with -token", err)
+		}
+		token = strings.TrimSpace(values[0])
+		if token == "" {
+			return "", fmt.Errorf("KUSTO_TOKEN must not be blank")
+		}
+	}
+
+	if expiresOn, ok := tokenExpiry(token); ok {
+		if !expiresOn.After(now) {
+			logger.Warn("Token has expired, requests will fail until a new one is supplied", "expiredOn", expiresOn)
+		} else {
+			logger.Debug("Using static token", "expiresOn", expiresOn)
+		}
+	}
+
+	return token, nil
+}
+
+// staticAccessToken reads the token for StaticToken auth, as getStaticToken does. It expires
+// as its exp claim says, or when it has none, staticTokenLifetime from now.
+func staticAccessToken(tokenFile string, now time.Time) (azcore.AccessToken, error) {
+	token, err := getStaticToken(tokenFile, now)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	expiresOn, ok := tokenExpiry(token)
+	if !ok {
+		expiresOn = now.Add(staticTokenLifetime)
+	}
+
+	return azcore.AccessToken{Token: token, ExpiresOn: expiresOn}, nil
+}
+
+// tokenExpiry returns the time of the exp claim of token, if it is a JWT with one. The
+// signature isn't checked, the service does that.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(exp), 0), true
+}
+
+// getAzBearerToken gets a bearer token from Azure Active Directory with the given options.
+// With useCache, a token cached under cacheKey by an earlier run is reused until it is about
+// to expire, and a newly acquired token is cached, so the device code prompt only appears when needed.
+func getAzBearerToken(ctx context.Context, cacheKey string, tokenOpts policy.TokenRequestOptions, clientOpts azcore.ClientOptions, useCache bool) (*azcore.AccessToken, error) {
+	var cachePath string
+	if useCache {
+		path, err := tokenCachePath()
+		if err != nil {
+			logger.Warn("Not caching the token", "error", err)
+		} else if token, ok := loadCachedToken(path, cacheKey); ok {
+			logger.Info("Using cached token", "expiresOn", token.ExpiresOn)
+			return token, nil
+		}
+		cachePath = path
+	}
+
+	cred, err := sharedDeviceCodeCredential(clientOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := cred.GetToken(ctx, tokenOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a token: %v", err)
+	}
+	logger.Debug("Acquired token", "expiresOn", token.ExpiresOn)
+
+	if cachePath != "" {
+		if err := storeCachedToken(cachePath, cacheKey, &token); err != nil {
+			logger.Warn("Failed to cache the token", "error", err)
+		}
+	}
+
+	return &token, nil
+}
+
+var (
+	deviceCodeMu   sync.Mutex
+	deviceCodeCred *azidentity.DeviceCodeCredential
+)
+
+// sharedDeviceCodeCredential returns the device code credential shared by every BearerToken
+// connection in the process. It keeps the signed in account in memory, so connecting to
+// further clusters gets their tokens silently instead of prompting again. The credential is
+// created with the clientOpts of the first call.
+func sharedDeviceCodeCredential(clientOpts azcore.ClientOptions) (*azidentity.DeviceCodeCredential, error) {
+	deviceCodeMu.Lock()
+	defer deviceCodeMu.Unlock()
+
+	if deviceCodeCred == nil {
+		cred, err := azidentity.NewDeviceCodeCredential(&azidentity.DeviceCodeCredentialOptions{ClientOptions: clientOpts})
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain a credential: %v", err)
+		}
+		deviceCodeCred = cred
+	}
+
+	return deviceCodeCred, nil
+}
+
+// tokenRequestOptions returns the options for requesting a token with the given scopes,
+// or scoped to the given cluster when there are none.
+func tokenRequestOptions(kustoURL string, scopes []string) policy.TokenRequestOptions {
+	if len(scopes) > 0 {
+		return policy.TokenRequestOptions{Scopes: scopes}
+	}
+
+	return policy.TokenRequestOptions{
+		Scopes: []string{fmt.Sprintf("%s/.default", kustoURL)},
+	}
+}
+
+// validateScope checks that scope looks like a token scope, a URL such as
+// https://kusto.kusto.windows.net/.default or api://<app id>/.default.
+func validateScope(scope string) error {
+	if scope == "" {
+		return fmt.Errorf("invalid scope: must not be empty")
+	}
+
+	u, err := url.Parse(scope)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid scope %q: must be a URL such as https://<cluster>/.default", scope)
+	}
+
+	return nil
+}
+
+// getServicePrincipalEnv reads the service principal credentials from the
+// AZURE_CLIENT_ID, AZURE_TENANT_ID and AZURE_CLIENT_SECRET environment variables.
+func getServicePrincipalEnv() (clientID, tenantID, clientSecret string, err error) {
+	values, err := requireEnv("service principal", "AZURE_CLIENT_ID", "AZURE_TENANT_ID", "AZURE_CLIENT_SECRET")
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return values[0], values[1], values[2], nil
+}
+
+// getServicePrincipalCertEnv reads the service principal from the AZURE_CLIENT_ID and AZURE_TENANT_ID
+// environment variables, and loads its PEM certificate and private key from AZURE_CLIENT_CERTIFICATE_PATH,
+// decrypting the key with the optional AZURE_CLIENT_CERTIFICATE_PASSWORD.
+func getServicePrincipalCertEnv() (clientID, tenantID, certPEM, password string, err error) {
+	values, err := requireEnv("service principal certificate", "AZURE_CLIENT_ID", "AZURE_TENANT_ID", "AZURE_CLIENT_CERTIFICATE_PATH")
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	certPath := values[2]
+	password = os.Getenv("AZURE_CLIENT_CERTIFICATE_PASSWORD")
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", "", "", "", fmt.Errorf("certificate file %q does not exist", certPath)
+		}
+		return "", "", "", "", fmt.Errorf("error reading certificate file %q: %w", certPath, err)
+	}
+
+	if err := validateCertificate(data, password); err != nil {
+		return "", "", "", "", fmt.Errorf("invalid certificate file %q: %w", certPath, err)
+	}
+
+	return values[0], values[1], string(data), password, nil
+}
+
+// validateCertificate checks that data holds a parseable certificate along with the private key matching it.
+func validateCertificate(data []byte, password string) error {
+	var pwd []byte
+	if password != "" {
+		pwd = []byte(password)
+	}
+
+	certs, key, err := azidentity.ParseCertificates(data, pwd)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(certs[0].PublicKey) {
+		return fmt.Errorf("private key does not match the certificate")
+	}
+
+	return nil
+}
+
+// getAzureCLICredential gets a credential for the account currently logged into the Azure CLI.
+func getAzureCLICredential(ctx context.Context, tokenOpts policy.TokenRequestOptions) (*azidentity.AzureCLICredential, error) {
+	cred, err := azidentity.NewAzureCLICredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure CLI credential: %w", err)
+	}
+
+	// Request a token up front so a missing or logged out CLI is reported here
+	// rather than failing later inside the Kusto client.
+	token, err := cred.GetToken(ctx, tokenOpts)
+	if err != nil {
+		return nil, fmt.Errorf("Azure CLI credential is unavailable, make sure the az CLI is installed and run `az login`: %w", err)
+	}
+	logger.Debug("Acquired token", "expiresOn", token.ExpiresOn)
+
+	return cred, nil
+}
+
+// getInteractiveBrowserCredential gets a credential that logs in through the system browser.
+// Unlike BearerToken's device code flow, which prints a code to enter on another device, it needs
+// a browser on the machine running the tool. AZURE_TENANT_ID optionally selects the tenant to log
+// into and AZURE_REDIRECT_URI the redirect URI registered for the application, which otherwise
+// defaults to a localhost URI on a random port.
+func getInteractiveBrowserCredential(ctx context.Context, tokenOpts policy.TokenRequestOptions, clientOpts azcore.ClientOptions) (*azidentity.InteractiveBrowserCredential, error) {
+	opts := &azidentity.InteractiveBrowserCredentialOptions{
+		ClientOptions: clientOpts,
+		TenantID:      os.Getenv("AZURE_TENANT_ID"),
+		RedirectURL:   os.Getenv("AZURE_REDIRECT_URI"),
+	}
+
+	cred, err := azidentity.NewInteractiveBrowserCredential(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create interactive browser credential: %w", err)
+	}
+
+	// Log in up front so that the browser opens now, rather than part way through ingesting.
+	token, err := cred.GetToken(ctx, tokenOpts)
+	if err != nil {
+		return nil, fmt.Errorf("interactive browser login failed, it requires a browser on this machine: %w", err)
+	}
+	logger.Debug("Acquired token", "expiresOn", token.ExpiresOn)
+
+	return cred, nil
+}
+
+// getWorkloadIdentityCredential gets a credential exchanging the federated token that AKS workload
+// identity projects into the pod. The AZURE_FEDERATED_TOKEN_FILE, AZURE_CLIENT_ID and AZURE_TENANT_ID
+// environment variables it reads are set by the workload identity webhook.
+func getWorkloadIdentityCredential(clientOpts azcore.ClientOptions) (*azidentity.WorkloadIdentityCredential, error) {
+	values, err := requireEnv("workload identity", "AZURE_FEDERATED_TOKEN_FILE", "AZURE_CLIENT_ID", "AZURE_TENANT_ID")
+	if err != nil {
+		return nil, err
+	}
+
+	tokenFile := values[0]
+	if _, err := os.Stat(tokenFile); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("federated token file %q does not exist, check that the pod's service account is annotated for workload identity", tokenFile)
+		}
+		return nil, fmt.Errorf("error reading federated token file %q: %w", tokenFile, err)
+	}
+
+	cred, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+		ClientOptions: clientOpts,
+		TokenFilePath: tokenFile,
+		ClientID:      values[1],
+		TenantID:      values[2],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workload identity credential: %w", err)
+	}
+
+	return cred, nil
+}
+
+// requireEnv reads the given environment variables, returning their values in order,
+// or an error listing every variable that isn't set.
+func requireEnv(authName string, names ...string) ([]string, error) {
+	values := make([]string, len(names))
+
+	var missing []string
+	for i, name := range names {
+		values[i] = os.Getenv(name)
+		if values[i] == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s auth requires environment variables to be set, missing: %s", authName, strings.Join(missing, ", "))
+	}
+
+	return values, nil
+}
+
+// getManagedIdentityCredential gets a managed identity credential for the hosting Azure resource.
+// A system-assigned identity is used unless AZURE_MANAGED_IDENTITY_CLIENT_ID selects a user-assigned one.
+func getManagedIdentityCredential(ctx context.Context, tokenOpts policy.TokenRequestOptions, clientOpts azcore.ClientOptions) (*azidentity.ManagedIdentityCredential, error) {
+	opts := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOpts}
+	if clientID := os.Getenv("AZURE_MANAGED_IDENTITY_CLIENT_ID"); clientID != "" {
+		opts.ID = azidentity.ClientID(clientID)
+	}
+
+	cred, err := azidentity.NewManagedIdentityCredential(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create managed identity credential: %w", err)
+	}
+
+	// The credential is only usable if the environment exposes a managed identity endpoint,
+	// so request a token up front rather than failing later inside the Kusto client.
+	token, err := cred.GetToken(ctx, tokenOpts)
+	if err != nil {
+		return nil, fmt.Errorf("managed identity is unavailable in this environment (requires an Azure VM, App Service or AKS pod with an assigned identity): %w", err)
+	}
+	logger.Debug("Acquired token", "expiresOn", token.ExpiresOn)
+
+	return cred, nil
+}
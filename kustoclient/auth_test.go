@@ -0,0 +1,241 @@
+package kustoclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenRequestOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		want   []string
+	}{
+		{name: "default scope", want: []string{DefaultKustoURL + "/.default"}},
+		{name: "custom scopes", scopes: []string{"https://kusto.kusto.usgovcloudapi.net/.default"}, want: []string{"https://kusto.kusto.usgovcloudapi.net/.default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenRequestOptions(DefaultKustoURL, tt.scopes).Scopes; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenRequestOptions() scopes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplicationForTracing(t *testing.T) {
+	tests := []struct {
+		name, appName, appVersion string
+		want                      string
+	}{
+		{name: "unset"},
+		{name: "version without name", appVersion: "1.2.0"},
+		{name: "name", appName: "loader", want: "loader"},
+		{name: "name and version", appName: "loader", appVersion: "1.2.0", want: "loader/1.2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AppName, cfg.AppVersion = tt.appName, tt.appVersion
+
+			if got := applicationForTracing(cfg); got != tt.want {
+				t.Errorf("applicationForTracing() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	tests := []struct {
+		scope   string
+		wantErr string
+	}{
+		{scope: "https://help.kusto.windows.net/.default"},
+		{scope: "api://00000000-0000-0000-0000-000000000000/.default"},
+		{scope: "", wantErr: "must not be empty"},
+		{scope: "user_impersonation", wantErr: "must be a URL"},
+		{scope: "https:///.default", wantErr: "must be a URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			err := validateScope(tt.scope)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateScope() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateScope() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testJWT returns an unsigned JWT carrying claims, a JSON object.
+func testJWT(claims string) string {
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestGetStaticToken(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	valid := testJWT(fmt.Sprintf(`{"aud":"https://help.kusto.windows.net","exp":%d}`, now.Add(time.Hour).Unix()))
+
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name      string
+		tokenFile string
+		env       string
+		want      string
+		wantErr   string
+	}{
+		{name: "env", env: valid, want: valid},
+		{name: "file", tokenFile: writeFile("token", valid+"\n"), env: "ignored", want: valid},
+		{name: "not a jwt", env: "opaque-token", want: "opaque-token"},
+		{name: "no env", wantErr: "missing: KUSTO_TOKEN"},
+		{name: "blank env", env: "  ", wantErr: "must not be blank"},
+		{name: "empty file", tokenFile: writeFile("empty", "\n"), wantErr: "is empty"},
+		{name: "missing file", tokenFile: filepath.Join(dir, "missing"), wantErr: "does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUSTO_TOKEN", tt.env)
+
+			got, err := getStaticToken(tt.tokenFile, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("getStaticToken() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getStaticToken() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getStaticToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "exp", token: testJWT(`{"exp":1717243200}`), want: time.Unix(1717243200, 0), wantOK: true},
+		{name: "no exp", token: testJWT(`{"aud":"https://help.kusto.windows.net"}`)},
+		{name: "not json", token: testJWT(`not json`)},
+		{name: "opaque", token: "opaque-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tokenExpiry(tt.token)
+			if !got.Equal(tt.want) || ok != tt.wantOK {
+				t.Errorf("tokenExpiry() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseAuthType(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    AuthType
+		wantErr bool
+	}{
+		{name: "BearerToken", want: BearerToken},
+		{name: "azurecli", want: AzureCLI},
+		{name: "bearer", want: BearerToken},
+		{name: "interactive", want: Interactive},
+		{name: "SP", want: ServicePrincipal},
+		{name: "sp-cert", want: ServicePrincipalCert},
+		{name: "msi", want: ManagedIdentity},
+		{name: "cli", want: AzureCLI},
+		{name: "browser", want: InteractiveBrowser},
+		{name: "workload", want: WorkloadIdentity},
+		{name: "token", want: StaticToken},
+		{name: "kerberos", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAuthType(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseAuthType() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAuthType() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAuthType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthTypeTextRoundTrip(t *testing.T) {
+	for _, a := range []AuthType{BearerToken, Interactive, ServicePrincipal, ManagedIdentity, ServicePrincipalCert, AzureCLI, InteractiveBrowser, WorkloadIdentity, StaticToken} {
+		t.Run(a.String(), func(t *testing.T) {
+			type config struct {
+				Auth AuthType `json:"auth"`
+			}
+
+			data, err := json.Marshal(config{Auth: a})
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if want := `{"auth":"` + a.String() + `"}`; string(data) != want {
+				t.Errorf("json.Marshal() = %s, want %s", data, want)
+			}
+
+			var got config
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if got.Auth != a {
+				t.Errorf("json.Unmarshal() = %v, want %v", got.Auth, a)
+			}
+		})
+	}
+}
+
+func TestAuthTypeText(t *testing.T) {
+	if _, err := AuthType(99).MarshalText(); err == nil {
+		t.Error("MarshalText() of an invalid auth type error = nil, want an error")
+	}
+
+	var a AuthType
+	if err := a.UnmarshalText([]byte("msi")); err != nil || a != ManagedIdentity {
+		t.Errorf("UnmarshalText(msi) = %v, %v, want %v", a, err, ManagedIdentity)
+	}
+	if err := a.UnmarshalText([]byte("kerberos")); err == nil {
+		t.Error("UnmarshalText(kerberos) error = nil, want an error")
+	}
+}
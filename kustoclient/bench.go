@@ -0,0 +1,140 @@
+package kustoclient
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// DefaultBenchRows is the number of rows Bench ingests each iteration when none is given.
+	DefaultBenchRows = 10000
+
+	// DefaultBenchIterations is the number of iterations Bench runs when none is given.
+	DefaultBenchIterations = 3
+)
+
+// RowsIngester ingests rows as data in a delimited format, as Client.IngestRowsAs does.
+type RowsIngester interface {
+	IngestRowsAs(ctx context.Context, rows [][]string, format string) error
+}
+
+// BenchResult is how long each iteration of Bench took to ingest its rows.
+type BenchResult struct {
+	// Rows is the number of rows ingested by each iteration.
+	Rows int
+
+	// Durations are how long the iterations took, in the order they ran.
+	Durations []time.Duration
+}
+
+// Min returns the duration of the fastest iteration.
+func (r BenchResult) Min() time.Duration {
+	var fastest time.Duration
+	for i, d := range r.Durations {
+		if i == 0 || d < fastest {
+			fastest = d
+		}
+	}
+
+	return fastest
+}
+
+// Max returns the duration of the slowest iteration.
+func (r BenchResult) Max() time.Duration {
+	var slowest time.Duration
+	for _, d := range r.Durations {
+		slowest = max(slowest, d)
+	}
+
+	return slowest
+}
+
+// Mean returns the mean duration of the iterations.
+func (r BenchResult) Mean() time.Duration {
+	if len(r.Durations) == 0 {
+		return 0
+	}
+
+	var total time.Duration
+	for _, d := range r.Durations {
+		total += d
+	}
+
+	return total / time.Duration(len(r.Durations))
+}
+
+// RowsPerSecond returns the rows ingested per second by an iteration of the mean duration.
+func (r BenchResult) RowsPerSecond() float64 {
+	mean := r.Mean()
+	if mean <= 0 {
+		return 0
+	}
+
+	return float64(r.Rows) / mean.Seconds()
+}
+
+// Bench ingests iterations batches of rows generated rows each into the configured table,
+// one after the other, and returns how long each took. The rows have the Timestamp,
+// FirstName and LastName columns of the default table, and are ingested as CSV data by
+// ingestor, whose table should be the configured one. An iteration lasts until Kusto
+// reports the ingestion's status, or for streaming ingestion, accepts the data, so it
+// measures the ingestion end to end.
+func Bench(ctx context.Context, ingestor RowsIngester, cfg Config, rows, iterations int) (_ BenchResult, err error) {
+	ctx, span := startSpan(ctx, "Bench", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	if rows <= 0 {
+		rows = DefaultBenchRows
+	}
+	if iterations <= 0 {
+		iterations = DefaultBenchIterations
+	}
+
+	span.SetAttributes(attribute.Int("kusto.rows", rows), attribute.Int("kusto.iterations", iterations))
+
+	result := BenchResult{Rows: rows}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 1; i <= iterations; i++ {
+		data := benchRows(rng, time.Now().UTC(), rows)
+
+		logger.Info("Running benchmark iteration...", "table", cfg.Table, "iteration", i, "iterations", iterations, "rows", rows)
+		start := time.Now()
+		if err := ingestor.IngestRowsAs(ctx, data, "csv"); err != nil {
+			return result, fmt.Errorf("benchmark iteration %d: %w", i, err)
+		}
+		elapsed := time.Since(start)
+		result.Durations = append(result.Durations, elapsed)
+
+		logger.Info("Benchmark iteration completed", "iteration", i, "duration", elapsed.Round(time.Millisecond).String(), "rowsPerSecond", int(float64(rows)/elapsed.Seconds()))
+	}
+
+	return result, nil
+}
+
+var (
+	benchFirstNames = []string{"Olivia", "Liam", "Emma", "Noah", "Ava", "Mateo", "Sofia", "Arjun", "Mei", "Kwame", "Fatima", "Lucas"}
+	benchLastNames  = []string{"Smith", "Garcia", "Patel", "Kim", "Nguyen", "Müller", "Rossi", "Okafor", "Silva", "Cohen", "Tanaka", "Brown"}
+)
+
+// benchRows generates n rows of a Timestamp, a millisecond apart going back from end, and a
+// FirstName and LastName picked by rng.
+func benchRows(rng *rand.Rand, end time.Time, n int) [][]string {
+	rows := make([][]string, n)
+	for i := range rows {
+		t := end.Add(-time.Duration(n-1-i) * time.Millisecond)
+		rows[i] = []string{
+			t.Format(time.RFC3339Nano),
+			benchFirstNames[rng.Intn(len(benchFirstNames))],
+			benchLastNames[rng.Intn(len(benchLastNames))],
+		}
+	}
+
+	return rows
+}
@@ -0,0 +1,87 @@
+package kustoclient
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBenchResult(t *testing.T) {
+	result := BenchResult{Rows: 1000, Durations: []time.Duration{2 * time.Second, time.Second, 3 * time.Second}}
+
+	if got := result.Min(); got != time.Second {
+		t.Errorf("Min() = %s, want 1s", got)
+	}
+	if got := result.Max(); got != 3*time.Second {
+		t.Errorf("Max() = %s, want 3s", got)
+	}
+	if got := result.Mean(); got != 2*time.Second {
+		t.Errorf("Mean() = %s, want 2s", got)
+	}
+	if got := result.RowsPerSecond(); got != 500 {
+		t.Errorf("RowsPerSecond() = %v, want 500", got)
+	}
+
+	if empty := (BenchResult{Rows: 1000}); empty.Mean() != 0 || empty.RowsPerSecond() != 0 {
+		t.Errorf("BenchResult with no iterations has mean %s and %v rows/s, want 0", empty.Mean(), empty.RowsPerSecond())
+	}
+}
+
+func TestBenchRows(t *testing.T) {
+	end := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	rows := benchRows(rand.New(rand.NewSource(1)), end, 3)
+
+	if len(rows) != 3 {
+		t.Fatalf("benchRows() returned %d rows, want 3", len(rows))
+	}
+	for i, want := range []string{"2024-06-01T11:59:59.998Z", "2024-06-01T11:59:59.999Z", "2024-06-01T12:00:00Z"} {
+		if rows[i][0] != want {
+			t.Errorf("benchRows() row %d has timestamp %s, want %s", i, rows[i][0], want)
+		}
+		if !slices.Contains(benchFirstNames, rows[i][1]) || !slices.Contains(benchLastNames, rows[i][2]) {
+			t.Errorf("benchRows() row %d = %v, want a first and last name from the lists", i, rows[i])
+		}
+	}
+}
+
+// rowsIngester ingests rows with IngestRowsAs, as a Client does.
+type rowsIngester struct {
+	ingestor Ingestor
+	cfg      Config
+}
+
+func (r rowsIngester) IngestRowsAs(ctx context.Context, rows [][]string, format string) error {
+	return IngestRowsAs(ctx, r.ingestor, r.cfg, rows, format)
+}
+
+func TestBench(t *testing.T) {
+	cfg := testConfig()
+	ingestor := &fakeIngestor{}
+
+	result, err := Bench(context.Background(), rowsIngester{ingestor, cfg}, cfg, 50, 2)
+	if err != nil {
+		t.Fatalf("Bench() error = %v", err)
+	}
+
+	if result.Rows != 50 || len(result.Durations) != 2 {
+		t.Errorf("Bench() = %d rows x %d iterations, want 50 x 2", result.Rows, len(result.Durations))
+	}
+	if len(ingestor.data) != 2 {
+		t.Fatalf("Bench() ingested %d times, want 2", len(ingestor.data))
+	}
+	for i, data := range ingestor.data {
+		if lines := strings.Count(data, "\n"); lines != 50 {
+			t.Errorf("Bench() iteration %d ingested %d lines, want 50", i+1, lines)
+		}
+	}
+
+	ingestor = &fakeIngestor{}
+	cfg.IngestMode = StreamingIngest
+	cfg.Tags = []string{"ingest-by:batch-1"}
+	if _, err := Bench(context.Background(), rowsIngester{ingestor, cfg}, cfg, 50, 2); err == nil || !strings.Contains(err.Error(), "benchmark iteration 1") {
+		t.Errorf("Bench() error = %v, want one from iteration 1", err)
+	}
+}
@@ -0,0 +1,181 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+// IngestBlob has the cluster ingest the Azure Storage blob at blobURL into the configured table.
+// The data is pulled straight from storage, so blobURL should carry a SAS granting read access
+// unless the cluster can read the blob with its own identity. rawSize, if positive, is the
+// uncompressed size of the blob in bytes, which helps the service plan the ingestion.
+// The blob's format is cfg.Format, or inferred from its name when that is empty.
+// Transient failures are retried up to cfg.MaxRetries times.
+func IngestBlob(ctx context.Context, ingestor Ingestor, cfg Config, blobURL string, rawSize int64) (err error) {
+	ctx, span := startSpan(ctx, "IngestBlob", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	u, err := parseBlobURL(blobURL)
+	if err != nil {
+		return err
+	}
+
+	// Never log or return the SAS, it is a credential.
+	redacted := redactBlobURL(u)
+
+	if err := checkCompression(u.Path); err != nil {
+		return err
+	}
+
+	formatName := cfg.Format
+	if formatName == "" {
+		_, uncompressed := fileCompression(u.Path)
+		formatName = strings.TrimPrefix(strings.ToLower(path.Ext(uncompressed)), ".")
+	}
+
+	format, err := parseFileFormat(formatName)
+	if err != nil {
+		return err
+	}
+	checkFormatExtension(cfg, u.Path)
+
+	formatOptions, err := fileFormatOptions(format, cfg)
+	if err != nil {
+		return err
+	}
+
+	headerOpts, err := headerOptions(cfg, format)
+	if err != nil {
+		return err
+	}
+
+	// The blob is never downloaded, so there is no record to drop from it.
+	if cfg.IgnoreLastRecord {
+		return fmt.Errorf("ignore last record can't be used with blob ingestion, Kusto has no ingestion property for it")
+	}
+
+	// The blob is never downloaded, so there is no data to derive a key from.
+	if cfg.IdempotencyKey == AutoIdempotencyKey {
+		return fmt.Errorf("an automatic idempotency key can't be used with blob ingestion, pass the key to tag the blob with instead")
+	}
+	cfg, err = withIdempotencyKey(cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	metaOptions, err := metadataOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	ingestOptions := append(formatOptions, headerOpts...)
+	ingestOptions = append(ingestOptions, reportingOptions(cfg)...)
+	ingestOptions = append(ingestOptions, metaOptions...)
+	if rawSize > 0 {
+		ingestOptions = append(ingestOptions, azkustoingest.RawDataSize(rawSize))
+	}
+
+	if cfg.DryRun {
+		logger.Info("Dry run, skipping ingestion", "table", cfg.Table, "blob", redacted, "format", format.String(), "options", optionNames(ingestOptions))
+		return nil
+	}
+
+	logger.Info("Ingesting blob...", "table", cfg.Table, "blob", redacted, "format", format.String())
+
+	return trackIngestion(func() error {
+		err := ingestAndWait(ctx, cfg, redacted, func() (*azkustoingest.Result, error) {
+			var status *azkustoingest.Result
+			err := withRetry(ctx, "ingest", cfg.MaxRetries, func() error {
+				var err error
+				logger.Debug("Submitting ingestion", "source", redacted, "options", optionNames(ingestOptions))
+				status, err = ingestor.FromFile(ctx, blobURL, ingestOptions...)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error ingesting blob %s: %w", redacted, streamingError(cfg, err))
+			}
+
+			return status, nil
+		})
+
+		var ingestionErr *IngestionError
+		if errors.As(err, &ingestionErr) && !ingestionErr.Partial() {
+			return fmt.Errorf("blob %s wasn't ingested, check that it exists and that its SAS grants read access and hasn't expired: %w", redacted, err)
+		}
+
+		return err
+	})
+}
+
+// parseBlobURL checks that blobURL is an https URL naming a blob in a container,
+// and that the SAS it carries, if any, hasn't expired.
+func parseBlobURL(blobURL string) (*url.URL, error) {
+	u, err := url.Parse(blobURL)
+	if err != nil {
+		// The error quotes the URL, SAS and all.
+		return nil, fmt.Errorf("invalid blob URL: malformed URL")
+	}
+
+	redacted := redactBlobURL(u)
+
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid blob URL %s: scheme must be https", redacted)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid blob URL %s: host must not be empty", redacted)
+	}
+
+	container, blob, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if container == "" || blob == "" {
+		return nil, fmt.Errorf("invalid blob URL %s: path must name a container and a blob", redacted)
+	}
+
+	sas := u.Query()
+	if sas.Get("sig") == "" {
+		logger.Warn("Blob URL has no SAS, the cluster must be able to read the blob with its own identity", "blob", redacted)
+		return u, nil
+	}
+
+	if expiry := sas.Get("se"); expiry != "" {
+		t, err := parseSASTime(expiry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob URL %s: SAS expiry %q: %w", redacted, expiry, err)
+		}
+		if time.Now().After(t) {
+			return nil, fmt.Errorf("the SAS of blob %s expired at %s", redacted, t.Format(time.RFC3339))
+		}
+	}
+
+	return u, nil
+}
+
+// parseSASTime parses a SAS start or expiry time, which is either a UTC date or a UTC date and time.
+func parseSASTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("not an ISO 8601 UTC time")
+}
+
+// redactBlobURL returns the blob URL without its query, which holds the SAS.
+func redactBlobURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	redacted.Fragment = ""
+
+	return redacted.String()
+}
@@ -0,0 +1,63 @@
+package kustoclient
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBlobURL(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr string
+	}{
+		{name: "with SAS", url: "https://acct.blob.core.windows.net/data/2024/rows.csv?sv=2022-11-02&se=" + future + "&sig=abc"},
+		{name: "without SAS", url: "https://acct.blob.core.windows.net/data/rows.csv"},
+		{name: "date only expiry", url: "https://acct.blob.core.windows.net/data/rows.csv?se=2999-01-01&sig=abc"},
+		{name: "http", url: "http://acct.blob.core.windows.net/data/rows.csv", wantErr: "scheme must be https"},
+		{name: "no blob", url: "https://acct.blob.core.windows.net/data", wantErr: "container and a blob"},
+		{name: "expired SAS", url: "https://acct.blob.core.windows.net/data/rows.csv?se=2020-01-01T00:00:00Z&sig=abc", wantErr: "expired"},
+		{name: "bad expiry", url: "https://acct.blob.core.windows.net/data/rows.csv?se=soon&sig=abc", wantErr: "SAS expiry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseBlobURL(tt.url)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseBlobURL() error = %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseBlobURL() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), "sig=") {
+				t.Errorf("parseBlobURL() error %q leaks the SAS", err)
+			}
+		})
+	}
+}
+
+func TestIngestBlob(t *testing.T) {
+	blobURL := "https://acct.blob.core.windows.net/data/rows.json.gz?sig=abc"
+
+	ingestor := &fakeIngestor{}
+	if err := IngestBlob(context.Background(), ingestor, testConfig(), blobURL, 1024); err != nil {
+		t.Fatalf("IngestBlob() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(ingestor.paths, []string{blobURL}) {
+		t.Errorf("IngestBlob() ingested %v, want %v", ingestor.paths, []string{blobURL})
+	}
+	wantOptions := []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "RawDataSize"}
+	if !reflect.DeepEqual(ingestor.options, [][]string{wantOptions}) {
+		t.Errorf("IngestBlob() options = %v, want %v", ingestor.options, wantOptions)
+	}
+}
@@ -0,0 +1,74 @@
+package kustoclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+)
+
+// Check checks that the database queried can be reached with client by running
+// .show version, and returns how long the command took to come back.
+func Check(ctx context.Context, client Querier, cfg Config) (_ time.Duration, err error) {
+	ctx, span := startSpan(ctx, "Check", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	start := time.Now()
+	if _, err := client.Mgmt(ctx, cfg.QueryDB(), kql.New(".show version")); err != nil {
+		return 0, fmt.Errorf("error running .show version: %w", err)
+	}
+
+	return time.Since(start), nil
+}
+
+// PingResult is what the print query run by Ping returned.
+type PingResult struct {
+	// ServerTime is the cluster's now() when it ran the query.
+	ServerTime time.Time
+
+	// Status is the constant the query printed, "ok".
+	Status string
+
+	// RoundTrip is how long the query took to come back.
+	RoundTrip time.Duration
+}
+
+// Ping checks that queries can be run against the database queried with client by
+// running a print query, which doesn't read any table and so costs next to nothing.
+// Unlike Check, it goes through the query endpoint rather than the management one.
+func Ping(ctx context.Context, client Querier, cfg Config) (_ PingResult, err error) {
+	ctx, span := startSpan(ctx, "Ping", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	start := time.Now()
+	rows, err := queryAll(ctx, client, cfg.QueryDB(), kql.New("print now(), 'ok'"), requestOptions(cfg, clientRequestID(cfg))...)
+	if err != nil {
+		return PingResult{}, fmt.Errorf("error running print: %w", err)
+	}
+	result := PingResult{RoundTrip: time.Since(start)}
+
+	if len(rows) != 1 {
+		return PingResult{}, fmt.Errorf("print returned %d rows", len(rows))
+	}
+
+	serverTime, err := rows[0].DateTimeByIndex(0)
+	if err != nil {
+		return PingResult{}, fmt.Errorf("error reading print result: %w", err)
+	}
+	if serverTime != nil {
+		result.ServerTime = *serverTime
+	}
+
+	if result.Status, err = rows[0].StringByIndex(1); err != nil {
+		return PingResult{}, fmt.Errorf("error reading print result: %w", err)
+	}
+
+	return result, nil
+}
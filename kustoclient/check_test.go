@@ -0,0 +1,43 @@
+package kustoclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+)
+
+// printDataset returns the dataset of a print now(), 'ok' query run at serverTime.
+func printDataset(serverTime time.Time) query.Dataset {
+	base := query.NewBaseDataset(context.Background(), kustoerrors.OpQuery, "PrimaryResult")
+	columns := []query.Column{
+		query.NewColumn(0, "print_0", types.DateTime),
+		query.NewColumn(1, "print_1", types.String),
+	}
+	table := query.NewBaseTable(base, 0, "0", "PrimaryResult", "PrimaryResult", columns)
+	row := query.NewRow(table, 0, []value.Kusto{value.NewDateTime(serverTime), value.NewString("ok")})
+
+	return query.NewDataset(base, []query.Table{query.NewTable(table, []query.Row{row})})
+}
+
+func TestPing(t *testing.T) {
+	serverTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	querier := &fakeQuerier{dataset: printDataset(serverTime)}
+	cfg := testConfig()
+
+	result, err := Ping(context.Background(), querier, cfg)
+	if err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	if querier.db != cfg.Database || querier.query != "print now(), 'ok'" {
+		t.Errorf("Ping() queried %q with %q, want %q with the print query", querier.db, querier.query, cfg.Database)
+	}
+	if !result.ServerTime.Equal(serverTime) || result.Status != "ok" {
+		t.Errorf("Ping() = %v, %q, want %v, \"ok\"", result.ServerTime, result.Status, serverTime)
+	}
+}
@@ -0,0 +1,152 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+// errClientClosed is returned by the methods of a Client that has been closed.
+var errClientClosed = errors.New("kusto client is closed")
+
+// querierCloser is a Querier that must be closed, as *azkustodata.Client is.
+type querierCloser interface {
+	Querier
+	io.Closer
+}
+
+// Client holds a query client and an ingestor connected to the configured cluster, so that
+// callers ingesting repeatedly connect once rather than for every ingestion. It is safe for
+// concurrent use: the underlying clients are, and Close waits for calls in progress to return.
+type Client struct {
+	cfg      Config
+	querier  querierCloser
+	ingestor azkustoingest.Ingestor
+
+	// mu is held for reading by calls in progress and for writing by Close.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewClient connects to the cluster in cfg and creates the query client and the ingestor
+// selected by cfg.IngestMode. The caller must Close the client.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	kcsb, err := Connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	querier, err := NewQueryClient(kcsb, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ingestor, err := NewIngestor(kcsb, cfg)
+	if err != nil {
+		querier.Close()
+		return nil, err
+	}
+
+	return &Client{cfg: cfg, querier: querier, ingestor: ingestor}, nil
+}
+
+// Config returns the config the client was created with.
+func (c *Client) Config() Config {
+	return c.cfg
+}
+
+// Querier returns the client's query client, for the functions taking a Querier.
+func (c *Client) Querier() Querier {
+	return c.querier
+}
+
+// Ingestor returns the client's ingestor, for the functions taking an Ingestor.
+// It ingests with the options of the client's config, so it should be used with the same config.
+func (c *Client) Ingestor() Ingestor {
+	return c.ingestor
+}
+
+// Ingest ingests a single inline row, as Ingest does.
+func (c *Client) Ingest(ctx context.Context) (int64, error) {
+	var rows int64
+	err := c.use(func() error {
+		var err error
+		rows, err = Ingest(ctx, c.ingestor, c.cfg)
+		return err
+	})
+
+	return rows, err
+}
+
+// IngestFile ingests the file at path, as IngestFile does.
+func (c *Client) IngestFile(ctx context.Context, path string) error {
+	return c.use(func() error {
+		return IngestFile(ctx, c.ingestor, c.cfg, path)
+	})
+}
+
+// IngestReader ingests the data read from r, as IngestReader does.
+func (c *Client) IngestReader(ctx context.Context, r io.Reader) error {
+	return c.use(func() error {
+		return IngestReader(ctx, c.ingestor, c.cfg, r)
+	})
+}
+
+// IngestRows ingests rows, as IngestRows does.
+func (c *Client) IngestRows(ctx context.Context, rows [][]string) error {
+	return c.use(func() error {
+		return IngestRows(ctx, c.ingestor, c.cfg, rows)
+	})
+}
+
+// IngestRowsAs ingests rows as data in format, as IngestRowsAs does.
+func (c *Client) IngestRowsAs(ctx context.Context, rows [][]string, format string) error {
+	return c.use(func() error {
+		return IngestRowsAs(ctx, c.ingestor, c.cfg, rows, format)
+	})
+}
+
+// Query writes the last rows of the configured table out, as Query does.
+func (c *Client) Query(ctx context.Context) error {
+	return c.use(func() error {
+		return Query(ctx, c.querier, c.cfg)
+	})
+}
+
+// Close waits for calls in progress to return, then closes the ingestor and the query client.
+// Calls made after Close return an error, and closing the client again does nothing.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if err := errors.Join(c.ingestor.Close(), c.querier.Close()); err != nil {
+		return fmt.Errorf("error closing kusto client: %w", err)
+	}
+
+	return nil
+}
+
+// use calls fn unless the client is closed, keeping it from being closed until fn returns.
+func (c *Client) use(fn func() error) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return errClientClosed
+	}
+
+	return fn()
+}
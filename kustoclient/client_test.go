@@ -0,0 +1,87 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// closeCounter counts the times it is closed.
+type closeCounter struct {
+	closes int
+}
+
+func (c *closeCounter) Close() error {
+	c.closes++
+	return nil
+}
+
+func TestClient(t *testing.T) {
+	ingestor := &fakeIngestor{}
+	ingestorCloser := &closeCounter{}
+	querierCloser := &closeCounter{}
+	client := &Client{
+		cfg: testConfig(),
+		querier: struct {
+			Querier
+			*closeCounter
+		}{&fakeQuerier{}, querierCloser},
+		ingestor: struct {
+			Ingestor
+			*closeCounter
+		}{ingestor, ingestorCloser},
+	}
+
+	// Ingestions share the client's ingestor.
+	const ingestions = 8
+	var wg sync.WaitGroup
+	errs := make([]error, ingestions)
+	for i := range ingestions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = client.IngestReader(context.Background(), strings.NewReader(fmt.Sprintf("%d,Sql,Isgood\n", i)))
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("IngestReader() error = %v", err)
+	}
+
+	got := append([]string(nil), ingestor.data...)
+	sort.Strings(got)
+	if len(got) != ingestions || got[0] != "0,Sql,Isgood\n" {
+		t.Errorf("IngestReader() ingested %q, want %d rows", got, ingestions)
+	}
+
+	if err := client.IngestRowsAs(context.Background(), [][]string{{"1", "Sql", "Isgood"}}, "psv"); err != nil {
+		t.Fatalf("IngestRowsAs() error = %v", err)
+	}
+	if last := ingestor.data[len(ingestor.data)-1]; last != "1|Sql|Isgood\n" {
+		t.Errorf("IngestRowsAs() ingested %q, want %q", last, "1|Sql|Isgood\n")
+	}
+
+	for range 2 {
+		if err := client.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	if ingestorCloser.closes != 1 || querierCloser.closes != 1 {
+		t.Errorf("Close() closed the ingestor %d times and the query client %d times, want once each", ingestorCloser.closes, querierCloser.closes)
+	}
+
+	if err := client.IngestReader(context.Background(), strings.NewReader("1,Sql,Isgood\n")); !errors.Is(err, errClientClosed) {
+		t.Errorf("IngestReader() after Close error = %v, want %v", err, errClientClosed)
+	}
+	if err := client.IngestRowsAs(context.Background(), [][]string{{"1", "Sql", "Isgood"}}, "csv"); !errors.Is(err, errClientClosed) {
+		t.Errorf("IngestRowsAs() after Close error = %v, want %v", err, errClientClosed)
+	}
+	if err := client.Query(context.Background()); !errors.Is(err, errClientClosed) {
+		t.Errorf("Query() after Close error = %v, want %v", err, errClientClosed)
+	}
+}
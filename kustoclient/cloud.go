@@ -0,0 +1,57 @@
+package kustoclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+// Cloud is the Azure cloud the cluster is in, which decides the AAD authority logged into.
+type Cloud int
+
+const (
+	PublicCloud Cloud = iota // Azure public cloud
+	USGovCloud               // Azure Government
+	ChinaCloud               // Azure China, operated by 21Vianet
+)
+
+// String returns the string representation of the Cloud.
+func (c Cloud) String() string {
+	switch c {
+	case PublicCloud:
+		return "public"
+	case USGovCloud:
+		return "usgov"
+	case ChinaCloud:
+		return "china"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseCloud maps a cloud name (public, usgov or china) to its Cloud.
+func ParseCloud(name string) (Cloud, error) {
+	for _, c := range []Cloud{PublicCloud, USGovCloud, ChinaCloud} {
+		if strings.EqualFold(name, c.String()) {
+			return c, nil
+		}
+	}
+
+	return PublicCloud, fmt.Errorf("unsupported cloud %q, supported clouds are: public, usgov, china", name)
+}
+
+// clientOptions returns the azidentity client options logging into the cloud's authority.
+func (c Cloud) clientOptions() (azcore.ClientOptions, error) {
+	switch c {
+	case PublicCloud:
+		return azcore.ClientOptions{Cloud: cloud.AzurePublic}, nil
+	case USGovCloud:
+		return azcore.ClientOptions{Cloud: cloud.AzureGovernment}, nil
+	case ChinaCloud:
+		return azcore.ClientOptions{Cloud: cloud.AzureChina}, nil
+	default:
+		return azcore.ClientOptions{}, fmt.Errorf("invalid cloud: %d", c)
+	}
+}
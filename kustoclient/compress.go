@@ -0,0 +1,131 @@
+package kustoclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+	"github.com/Azure/azure-kusto-go/azkustoingest/ingestoptions"
+)
+
+// compressionExtensions maps the extensions of compressed files to their compression type.
+var compressionExtensions = map[string]ingestoptions.CompressionType{
+	".gz":  ingestoptions.GZIP,
+	".zip": ingestoptions.ZIP,
+}
+
+// unsupportedCompressionExtensions maps the extensions of compressed files that Kusto can't
+// ingest to the name of their compression.
+var unsupportedCompressionExtensions = map[string]string{
+	".bz2":  "bzip2",
+	".xz":   "xz",
+	".zst":  "zstd",
+	".lz4":  "lz4",
+	".7z":   "7z",
+	".br":   "brotli",
+	".lzma": "lzma",
+}
+
+// checkCompression checks that the file at path, going by its extension, is either
+// uncompressed or compressed in a way Kusto can ingest: gzip or zip.
+func checkCompression(path string) error {
+	if name, ok := unsupportedCompressionExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return fmt.Errorf("%q is compressed with %s, which Kusto can't ingest, only gzip (.gz) and zip (.zip) are supported", path, name)
+	}
+
+	return nil
+}
+
+// fileCompression returns the compression of the file at path, going by its extension,
+// and the path without the compression extension, as data.csv for data.csv.gz.
+func fileCompression(path string) (ingestoptions.CompressionType, string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if c, ok := compressionExtensions[ext]; ok {
+		return c, strings.TrimSuffix(path, filepath.Ext(path))
+	}
+
+	return ingestoptions.CTNone, path
+}
+
+// compressedSource returns the path of the file to upload in place of the file at path, and the
+// options describing its compression. Already compressed files are uploaded as they are. Otherwise,
+// when cfg.Compress is set, the file is gzipped to a temp file first. The returned cleanup func
+// removes any temp file, unless cfg.KeepSource is set, and must always be called, including when
+// an error is returned.
+func compressedSource(cfg Config, path string) (string, []azkustoingest.FileOption, func(), error) {
+	noop := func() {}
+
+	if c, _ := fileCompression(path); c != ingestoptions.CTNone {
+		return path, []azkustoingest.FileOption{azkustoingest.CompressionType(c)}, noop, nil
+	}
+
+	if !cfg.Compress {
+		return path, nil, noop, nil
+	}
+
+	tmp, err := os.CreateTemp("", "kusto-ingest-*"+filepath.Ext(path)+".gz")
+	if err != nil {
+		return "", nil, noop, fmt.Errorf("error creating temp file to compress %q: %w", path, err)
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+
+	err = gzipFile(path, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, noop, fmt.Errorf("error compressing %q: %w", path, err)
+	}
+
+	if cfg.KeepSource {
+		logger.Info("Keeping compressed file", "path", path, "compressed", tmp.Name())
+		cleanup = noop
+	}
+
+	return tmp.Name(), []azkustoingest.FileOption{azkustoingest.CompressionType(ingestoptions.GZIP)}, cleanup, nil
+}
+
+// gzipFile writes the gzipped contents of the file at path to dst, then reads dst back
+// to check that it decompresses to exactly the original contents.
+func gzipFile(path string, dst *os.File) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	original := sha256.New()
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	if _, err := io.Copy(zw, io.TeeReader(src, original)); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(dst)
+	if err != nil {
+		return err
+	}
+	roundTrip := sha256.New()
+	if _, err := io.Copy(roundTrip, zr); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(original.Sum(nil), roundTrip.Sum(nil)) {
+		return fmt.Errorf("compressed data doesn't match the original")
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package kustoclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+	"github.com/Azure/azure-kusto-go/azkustoingest/ingestoptions"
+)
+
+func TestFileCompression(t *testing.T) {
+	tests := []struct {
+		path             string
+		wantCompression  ingestoptions.CompressionType
+		wantUncompressed string
+	}{
+		{path: "data.csv.gz", wantCompression: ingestoptions.GZIP, wantUncompressed: "data.csv"},
+		{path: "data.json.gz", wantCompression: ingestoptions.GZIP, wantUncompressed: "data.json"},
+		{path: "DATA.CSV.GZ", wantCompression: ingestoptions.GZIP, wantUncompressed: "DATA.CSV"},
+		{path: "export/data.csv.zip", wantCompression: ingestoptions.ZIP, wantUncompressed: "export/data.csv"},
+		{path: "data.csv", wantCompression: ingestoptions.CTNone, wantUncompressed: "data.csv"},
+		{path: "data.csv.bz2", wantCompression: ingestoptions.CTNone, wantUncompressed: "data.csv.bz2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			compression, uncompressed := fileCompression(tt.path)
+			if compression != tt.wantCompression || uncompressed != tt.wantUncompressed {
+				t.Errorf("fileCompression() = %v, %q, want %v, %q", compression, uncompressed, tt.wantCompression, tt.wantUncompressed)
+			}
+		})
+	}
+}
+
+func TestIngestCompressedFile(t *testing.T) {
+	tests := []struct {
+		file        string
+		wantFormat  azkustoingest.DataFormat
+		wantOptions []string
+		wantErr     string
+	}{
+		{file: "data.csv.gz", wantFormat: azkustoingest.CSV, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "CompressionType"}},
+		{file: "data.json.gz", wantFormat: azkustoingest.JSON, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "CompressionType"}},
+		{file: "data.tsv.zip", wantFormat: azkustoingest.TSV, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "CompressionType"}},
+		{file: "data.csv", wantFormat: azkustoingest.CSV, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{file: "data.csv.bz2", wantErr: "compressed with bzip2, which Kusto can't ingest"},
+		{file: "data.json.zst", wantErr: "compressed with zstd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg := testConfig()
+
+			format, _, err := fileIngestOptions(cfg, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fileIngestOptions() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fileIngestOptions() error = %v", err)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("fileIngestOptions() format = %v, want %v", format, tt.wantFormat)
+			}
+
+			ingestor := &fakeIngestor{}
+			if err := IngestFile(context.Background(), ingestor, cfg, path); err != nil {
+				t.Fatalf("IngestFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(ingestor.options, [][]string{tt.wantOptions}) {
+				t.Errorf("IngestFile() options = %v, want %v", ingestor.options, tt.wantOptions)
+			}
+		})
+	}
+}
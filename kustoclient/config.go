@@ -0,0 +1,384 @@
+package kustoclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultKustoURL is the URL of the Kusto cluster used when none is configured.
+	DefaultKustoURL = "https://ravpateadx.eastus.kusto.windows.net"
+
+	// DefaultDatabase is the database used when none is configured.
+	DefaultDatabase = "ArcSqlTelemetry"
+
+	// DefaultTable is the table used when none is configured.
+	DefaultTable = "ravpateTable"
+
+	// DefaultLimit is the number of rows returned by Query when none is configured.
+	DefaultLimit = 5
+
+	// DefaultPageSize is the number of rows Query writes at a time when none is configured.
+	DefaultPageSize = 1000
+)
+
+// Config describes the Kusto cluster, database and table to work against,
+// and how to authenticate and ingest.
+type Config struct {
+	// ClusterURL is the https URL of the Kusto cluster.
+	ClusterURL string
+
+	// Database is the name of the database to ingest into and query.
+	Database string
+
+	// IngestDatabase and QueryDatabase, if set, are the databases ingested into and queried
+	// instead of Database, as when ingesting into a staging database and querying a view of it
+	// in another. Creating the table, checking it exists and verifying an ingestion use the
+	// ingest database, and queries, counts, commands and checks the query database.
+	IngestDatabase, QueryDatabase string
+
+	// Table is the name of the table to ingest into and query.
+	Table string
+
+	// AuthType is the authentication mechanism used to connect to the cluster.
+	AuthType AuthType
+
+	// Cloud is the Azure cloud the cluster is in. AzureCLI auth logs into the cloud
+	// selected with az cloud set instead.
+	Cloud Cloud
+
+	// Scopes, if set, replace the default <ClusterURL>/.default scope of the tokens requested to
+	// authenticate, as needed for some national clouds. The Kusto client requests its own tokens
+	// for auth types that pass it a credential, so they only change the tokens requested up front.
+	Scopes []string
+
+	// ProxyURL, if set, is the http or https proxy the Kusto client and credentials connect through.
+	// The ingest clients create their own HTTP client, only honoring the HTTPS_PROXY environment variable.
+	ProxyURL string
+
+	// CACertFile, if set, is a PEM file of CA certificates trusted in addition to the system's,
+	// as needed behind a TLS inspecting proxy. Like ProxyURL, it doesn't apply to the ingest clients.
+	CACertFile string
+
+	// TokenFile, if set, is the file StaticToken auth reads its token from, instead of the
+	// KUSTO_TOKEN environment variable.
+	TokenFile string
+
+	// AppName and AppVersion, if set, are the application requests identify themselves as,
+	// which .show queries and .show commands list them under.
+	AppName    string
+	AppVersion string
+
+	// NoTokenCache makes BearerToken auth prompt for a new token instead of reusing
+	// one cached in the user's config directory by an earlier run.
+	NoTokenCache bool
+
+	// Format is the data format of ingested files and readers: one of the delimited formats
+	// csv, tsv, psv, scsv and sohsv, or json, multijson, parquet or avro.
+	// Parquet and Avro are usually ingested with a Mapping, as Kusto otherwise matches columns by name.
+	// When empty it is inferred from the file extension, or sniffed from the data for readers.
+	Format string
+
+	// Compress gzips uncompressed files before ingesting them. Files with a .gz or .zip
+	// extension are always ingested as compressed, whether or not it is set.
+	Compress bool
+
+	// Mapping optionally names a pre-created ingestion mapping on the table. Its kind is
+	// derived from Format. It only applies to files and readers, not the inline row.
+	Mapping string
+
+	// MappingJSON optionally is an ingestion mapping given inline, as the JSON array of its
+	// column mappings, for data whose mapping isn't created on the table. It applies as Mapping
+	// does, can't be combined with it, and isn't supported by streaming ingestion.
+	MappingJSON string
+
+	// NoFlushImmediately leaves queued ingestions to be batched by the table's ingestion
+	// batching policy, rather than flushed as soon as they are queued. Batching is more
+	// efficient for steady streams of small ingestions, but their status only arrives once
+	// the batch is sealed, minutes later with the default policy.
+	NoFlushImmediately bool
+
+	// KeepSource keeps the temp files data is ingested from, the inline ingest command,
+	// files gzipped for Compress and files copied without their last record for
+	// IgnoreLastRecord, logging their paths instead of removing them, so that what was
+	// ingested can be inspected.
+	KeepSource bool
+
+	// SkipHeader makes Kusto skip the first record of delimited data, such as the header
+	// row of a CSV file. It isn't supported by streaming ingestion.
+	SkipHeader bool
+
+	// IgnoreLastRecord drops the last record of delimited data before it is ingested, such
+	// as the incomplete record of a file still being written, or a footer. Kusto has no
+	// ingestion property for it, so the record is dropped from a copy of the data, which
+	// rules out blobs, which are never downloaded, and compressed files.
+	IgnoreLastRecord bool
+
+	// DeadLetterDir, if set, is the directory IngestFile, IngestDirectory and IngestManifest
+	// copy each file that fails to ingest into, next to a .err file holding the reason, for
+	// Replay to ingest again later. Files of a manifest going into another table than the
+	// configured one aren't, as Replay ingests into the configured table.
+	DeadLetterDir string
+
+	// MaxRetries is the number of times a transiently failing ingestion is retried.
+	MaxRetries int
+
+	// RetryFailed makes an ingestion that Kusto accepted, but then reported as failed
+	// transiently, be ingested again, up to MaxRetries times. Without it only failures to
+	// submit the ingestion are retried.
+	RetryFailed bool
+
+	// Concurrency is the number of files IngestDirectory ingests at once. Zero means runtime.NumCPU().
+	Concurrency int
+
+	// Limit is the number of rows returned by Query. Zero means DefaultLimit.
+	Limit int
+
+	// Columns, if set, are the only columns Query returns, in the given order.
+	Columns []string
+
+	// Since, if set, limits Query to rows whose Timestamp is within that long of now.
+	// It can't be combined with From or To.
+	Since time.Duration
+
+	// From and To, if set, limit Query to rows whose Timestamp is at or after From and at
+	// or before To.
+	From, To time.Time
+
+	// PageSize is the number of rows an iterative Query buffers before writing them out and
+	// checking for cancellation, which bounds its memory however many rows come back.
+	// Zero means DefaultPageSize.
+	PageSize int
+
+	// IngestMode selects the ingestion client. Streaming requires the table to have a
+	// streaming ingestion policy enabled.
+	IngestMode IngestMode
+
+	// ServerTimeout, if set, is how long the cluster lets Query run before cancelling it.
+	// Zero leaves it to the SDK, which derives it from the context's deadline.
+	ServerTimeout time.Duration
+
+	// RequestID is the client request ID Query is sent with, which identifies it in the
+	// cluster's .show queries. Empty means a new ID is generated for each query.
+	RequestID string
+
+	// NonIterative makes Query fetch the whole result in one non-iterative query instead of
+	// streaming it. It is simpler for small results, which is all Query asks for.
+	NonIterative bool
+
+	// Raw makes Query write every table of the response, as a line of JSON each, rather than
+	// the rows of the primary result in Output format: the primary result followed by the
+	// query properties and completion information. It makes failed ingestions write out their
+	// full status record too. Both go to Out.
+	Raw bool
+
+	// Output is how Query writes the rows it gets back.
+	Output OutputFormat
+
+	// Out is where Query writes rows for output formats other than LogOutput.
+	// Nil means os.Stdout.
+	Out io.Writer
+
+	// PollInterval is how long to wait for a queued ingestion to complete before reporting it
+	// as pending. Each later report waits twice as long, up to MaxPollInterval.
+	// Zero means DefaultPollInterval.
+	PollInterval time.Duration
+
+	// MaxPollInterval is the longest wait between reports of a pending ingestion.
+	// Zero means DefaultMaxPollInterval.
+	MaxPollInterval time.Duration
+
+	// NoProgress turns off the reports of pending ingestions, as for logs nobody watches
+	// live. They are also left out when the logger doesn't log at info level.
+	NoProgress bool
+
+	// CreationTime, if set, overrides the creation time of the ingested extents, as when
+	// backfilling historical data. It isn't supported by streaming ingestion.
+	CreationTime time.Time
+
+	// Tags are attached to the ingested extents. Each must be an ingest-by: or drop-by: tag.
+	// They aren't supported by streaming ingestion.
+	Tags []string
+
+	// IngestIfNotExists, if set, makes Kusto skip the ingestion when the table already has
+	// data tagged ingest-by:<IngestIfNotExists>, so that re-running a batch doesn't ingest it
+	// twice. The matching ingest-by: tag must be in Tags for a re-run to be detected.
+	IngestIfNotExists string
+
+	// Properties are Kusto ingestion properties, by name, to set on every ingestion other than
+	// streaming, for those that have no field of their own. Only ignoreFirstRecord,
+	// validationPolicy and creationTime can be set, the others, which UnknownProperties
+	// lists, are ignored.
+	Properties map[string]string
+
+	// IdempotencyKey, if set, tags each ingestion ingest-by:<key> and has Kusto skip it if the
+	// table already has data with that tag, so a retried or re-run ingestion isn't ingested
+	// twice. AutoIdempotencyKey derives the key from the SHA-256 hash of the data ingested.
+	// It can't be combined with IngestIfNotExists, and isn't supported by streaming ingestion.
+	IdempotencyKey string
+
+	// DryRun validates and logs what would be ingested without ingesting anything.
+	DryRun bool
+}
+
+// IngestDB returns the database ingested into: IngestDatabase, or Database when that is empty.
+func (c Config) IngestDB() string {
+	if c.IngestDatabase != "" {
+		return c.IngestDatabase
+	}
+
+	return c.Database
+}
+
+// QueryDB returns the database queried: QueryDatabase, or Database when that is empty.
+func (c Config) QueryDB() string {
+	if c.QueryDatabase != "" {
+		return c.QueryDatabase
+	}
+
+	return c.Database
+}
+
+// Validate checks that the config is complete and well-formed.
+func (c Config) Validate() error {
+	return categorize(ErrConfig, c.validate())
+}
+
+func (c Config) validate() error {
+	if err := validateKustoURL(c.ClusterURL); err != nil {
+		return err
+	}
+
+	if c.Database == "" {
+		return fmt.Errorf("database must not be empty")
+	}
+
+	if c.Table == "" {
+		return fmt.Errorf("table must not be empty")
+	}
+
+	for _, scope := range c.Scopes {
+		if err := validateScope(scope); err != nil {
+			return err
+		}
+	}
+
+	if c.Format != "" {
+		if _, err := parseFileFormat(c.Format); err != nil {
+			return err
+		}
+	}
+
+	if c.Limit < 0 {
+		return fmt.Errorf("invalid limit %d: must be positive", c.Limit)
+	}
+
+	if c.Since < 0 {
+		return fmt.Errorf("invalid since %s: must not be negative", c.Since)
+	}
+
+	if c.Since > 0 && (!c.From.IsZero() || !c.To.IsZero()) {
+		return fmt.Errorf("since can't be combined with from or to")
+	}
+
+	if !c.From.IsZero() && !c.To.IsZero() && c.From.After(c.To) {
+		return fmt.Errorf("invalid time range: from %s is after to %s", c.From.Format(time.RFC3339), c.To.Format(time.RFC3339))
+	}
+
+	for _, column := range c.Columns {
+		if err := validateColumn(column); err != nil {
+			return err
+		}
+	}
+
+	if c.PageSize < 0 {
+		return fmt.Errorf("invalid page size %d: must not be negative", c.PageSize)
+	}
+
+	if c.ServerTimeout < 0 {
+		return fmt.Errorf("invalid server timeout %s: must not be negative", c.ServerTimeout)
+	}
+
+	if c.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency %d: must not be negative", c.Concurrency)
+	}
+
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("invalid max retries %d: must not be negative", c.MaxRetries)
+	}
+
+	if c.PollInterval < 0 {
+		return fmt.Errorf("invalid poll interval %s: must not be negative", c.PollInterval)
+	}
+
+	if c.MaxPollInterval < 0 {
+		return fmt.Errorf("invalid max poll interval %s: must not be negative", c.MaxPollInterval)
+	}
+
+	if c.PollInterval > 0 && c.MaxPollInterval > 0 && c.PollInterval > c.MaxPollInterval {
+		return fmt.Errorf("invalid poll interval %s: must not be longer than the max poll interval %s", c.PollInterval, c.MaxPollInterval)
+	}
+
+	if err := validateMapping(c); err != nil {
+		return err
+	}
+	if _, err := metadataOptions(c); err != nil {
+		return err
+	}
+	if err := validateIdempotencyKey(c); err != nil {
+		return err
+	}
+	if _, err := httpClient(c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateMapping checks that at most one of cfg.Mapping and cfg.MappingJSON is set, and that
+// cfg.MappingJSON is a JSON array of column mapping objects that the ingest mode supports.
+// What the mappings say is left to Kusto to check.
+func validateMapping(cfg Config) error {
+	if cfg.MappingJSON == "" {
+		return nil
+	}
+
+	if cfg.Mapping != "" {
+		return fmt.Errorf("mapping and mapping JSON can't be used together")
+	}
+
+	var columns []map[string]any
+	if err := json.Unmarshal([]byte(cfg.MappingJSON), &columns); err != nil {
+		return fmt.Errorf("invalid mapping JSON: must be an array of column mappings: %w", err)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("invalid mapping JSON: no column mappings")
+	}
+
+	if cfg.IngestMode == StreamingIngest {
+		return fmt.Errorf("an inline ingestion mapping can't be used with streaming ingestion, use a pre-created mapping or queued ingestion instead")
+	}
+
+	return nil
+}
+
+// validateKustoURL checks that the cluster URL is a well-formed https URL with a host.
+func validateKustoURL(kustoURL string) error {
+	u, err := url.Parse(kustoURL)
+	if err != nil {
+		return fmt.Errorf("invalid cluster URL %q: %w", kustoURL, err)
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Errorf("invalid cluster URL %q: scheme must be https", kustoURL)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("invalid cluster URL %q: host must not be empty", kustoURL)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package kustoclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// staticTokenLifetime is how long a static token without an exp claim is used for before it
+// is read again, in case it was replaced.
+const staticTokenLifetime = 15 * time.Minute
+
+// refreshingCredential is an azcore.TokenCredential handing out a token until it is within
+// tokenExpiryMargin of expiring, then getting a new one with acquire. It lets the clients
+// of a long run, such as one following a file, keep authenticating with tokens that are
+// only acquired by hand, like BearerToken's and StaticToken's.
+//
+// The token is for the scopes acquire requests, whatever a client asks for, just as when
+// the clients were given the token itself.
+type refreshingCredential struct {
+	acquire func(ctx context.Context) (azcore.AccessToken, error)
+	now     func() time.Time
+
+	mu    sync.Mutex
+	token azcore.AccessToken
+}
+
+// newRefreshingCredential acquires a token with acquire straight away, so that failing to
+// authenticate fails the connection rather than its first request, and returns a credential
+// refreshing it.
+func newRefreshingCredential(ctx context.Context, acquire func(ctx context.Context) (azcore.AccessToken, error)) (*refreshingCredential, error) {
+	token, err := acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &refreshingCredential{acquire: acquire, now: time.Now, token: token}, nil
+}
+
+// GetToken implements azcore.TokenCredential.
+func (c *refreshingCredential) GetToken(ctx context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.ExpiresOn.Sub(c.now()) >= tokenExpiryMargin {
+		return c.token, nil
+	}
+
+	logger.Info("Token is about to expire, refreshing it", "expiresOn", c.token.ExpiresOn)
+	token, err := c.acquire(ctx)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	c.token = token
+
+	return token, nil
+}
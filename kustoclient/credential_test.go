@@ -0,0 +1,87 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+func TestRefreshingCredential(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	// Each token acquired is valid for an hour, and the third attempt fails.
+	acquired := 0
+	acquire := func(ctx context.Context) (azcore.AccessToken, error) {
+		acquired++
+		if acquired == 3 {
+			return azcore.AccessToken{}, errors.New("device code expired")
+		}
+		return azcore.AccessToken{Token: fmt.Sprintf("token-%d", acquired), ExpiresOn: now.Add(time.Hour)}, nil
+	}
+
+	cred, err := newRefreshingCredential(context.Background(), acquire)
+	if err != nil {
+		t.Fatalf("newRefreshingCredential() error = %v", err)
+	}
+	cred.now = func() time.Time { return now }
+
+	steps := []struct {
+		name     string
+		at       time.Duration
+		want     string
+		wantErr  bool
+		acquired int
+	}{
+		{name: "valid token is reused", at: 30 * time.Minute, want: "token-1", acquired: 1},
+		{name: "token about to expire is refreshed", at: time.Hour - tokenExpiryMargin + time.Second, want: "token-2", acquired: 2},
+		{name: "refreshed token is reused", at: time.Hour, want: "token-2", acquired: 2},
+		{name: "failed refresh is returned", at: 3 * time.Hour, wantErr: true, acquired: 3},
+		{name: "expired token is refreshed again", at: 3*time.Hour + time.Second, want: "token-4", acquired: 4},
+	}
+
+	for _, step := range steps {
+		now = start.Add(step.at)
+
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"https://help.kusto.windows.net/.default"}})
+		if step.wantErr != (err != nil) {
+			t.Fatalf("%s: GetToken() error = %v, want error %v", step.name, err, step.wantErr)
+		}
+		if token.Token != step.want {
+			t.Errorf("%s: GetToken() = %q, want %q", step.name, token.Token, step.want)
+		}
+		if acquired != step.acquired {
+			t.Errorf("%s: acquired %d tokens, want %d", step.name, acquired, step.acquired)
+		}
+	}
+}
+
+func TestStaticAccessToken(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// A token that has expired is still returned, for the service to reject.
+	expired := testJWT(fmt.Sprintf(`{"exp":%d}`, now.Add(-time.Minute).Unix()))
+	t.Setenv("KUSTO_TOKEN", expired)
+	token, err := staticAccessToken("", now)
+	if err != nil {
+		t.Fatalf("staticAccessToken() error = %v", err)
+	}
+	if token.Token != expired || !token.ExpiresOn.Equal(now.Add(-time.Minute)) {
+		t.Errorf("staticAccessToken() = %q expiring %v, want the token expiring %v", token.Token, token.ExpiresOn, now.Add(-time.Minute))
+	}
+
+	// Without an exp claim, it is read again after staticTokenLifetime.
+	t.Setenv("KUSTO_TOKEN", "opaque-token")
+	token, err = staticAccessToken("", now)
+	if err != nil {
+		t.Fatalf("staticAccessToken() error = %v", err)
+	}
+	if !token.ExpiresOn.Equal(now.Add(staticTokenLifetime)) {
+		t.Errorf("staticAccessToken() expires %v, want %v", token.ExpiresOn, now.Add(staticTokenLifetime))
+	}
+}
@@ -0,0 +1,255 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// deadLetterErrExt is the extension of the file next to each dead-lettered file holding the
+// reason its ingestion failed.
+const deadLetterErrExt = ".err"
+
+// deadLetterPartialExt is appended to the name of a dead-lettered file whose replay partly
+// succeeded, taking it out of later replays, which would duplicate the records that were
+// ingested.
+const deadLetterPartialExt = ".partial"
+
+// deadLetter copies the file at path, whose ingestion failed with ingestErr, into
+// cfg.DeadLetterDir, next to a .err file holding ingestErr, so that Replay can ingest it again
+// later. Ingestions that may still complete, because waiting for them was interrupted, and
+// those that partly succeeded, which ingesting again would duplicate, are left out. It returns
+// ingestErr, joined with the error copying the file if that failed.
+func deadLetter(cfg Config, path string, ingestErr error) error {
+	if cfg.DeadLetterDir == "" || !shouldDeadLetter(ingestErr) {
+		return ingestErr
+	}
+
+	parked, err := parkFile(cfg.DeadLetterDir, path, ingestErr)
+	if err != nil {
+		return errors.Join(ingestErr, fmt.Errorf("error copying %q to the dead-letter directory: %w", path, err))
+	}
+	logger.Warn("Ingestion failed, copied the file to the dead-letter directory", "path", path, "deadLetter", parked)
+
+	return ingestErr
+}
+
+// shouldDeadLetter reports whether a file whose ingestion ended with err should be ingested again.
+func shouldDeadLetter(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var ingestionErr *IngestionError
+	return !errors.As(err, &ingestionErr) || !ingestionErr.Partial()
+}
+
+// parkFile copies the file at path into dir, creating dir if needed, under the file's name or,
+// if that is taken, the name numbered so that it isn't, and writes reason to the .err file next
+// to it. It returns the path of the copy.
+func parkFile(dir, path string, reason error) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := createUnique(dir, filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = writeDeadLetterReason(dst.Name(), reason)
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+
+	return dst.Name(), nil
+}
+
+// createUnique creates a new file named name in dir, or when a file of that name exists, the
+// first of name-1, name-2 and so on, before the extensions, that doesn't.
+func createUnique(dir, name string) (*os.File, error) {
+	stem, ext := splitName(name)
+	for i := 0; ; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = stem + "-" + strconv.Itoa(i) + ext
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, err
+	}
+}
+
+// splitName splits a file name into its stem and its extensions, such as data and .csv.gz.
+func splitName(name string) (string, string) {
+	if i := strings.Index(name[1:], "."); i >= 0 {
+		return name[:i+1], name[i+1:]
+	}
+
+	return name, ""
+}
+
+// writeDeadLetterReason writes reason to the .err file of the dead-lettered file at path.
+func writeDeadLetterReason(path string, reason error) error {
+	return os.WriteFile(path+deadLetterErrExt, []byte(reason.Error()+"\n"), 0o644)
+}
+
+// Replay ingests again every file in dir, a dead-letter directory that failed ingestions were
+// copied to with Config.DeadLetterDir, into the configured table. The files are ingested as
+// IngestDirectory ingests a directory. Each file that is ingested is removed, along with its
+// .err file, and the .err file of each that fails again is updated with the new reason,
+// leaving it for a later replay. Each whose ingestion partly succeeds is renamed with a
+// .partial extension, next to a .err file holding the reason, so that it isn't replayed
+// again. The failures are returned together as a single error. A fixed cfg.IdempotencyKey
+// is refused: every file would be tagged alike, and Kusto would skip all but the first,
+// which would then be removed as if they had been ingested.
+func Replay(ctx context.Context, ingestor Ingestor, cfg Config, dir string) (err error) {
+	ctx, span := startSpan(ctx, "Replay", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	if cfg.IdempotencyKey != "" && cfg.IdempotencyKey != AutoIdempotencyKey {
+		return fmt.Errorf("a fixed idempotency key can't be used to replay a dead-letter directory, use %s instead", AutoIdempotencyKey)
+	}
+
+	paths, err := deadLetterFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		logger.Info("No files to replay.", "dir", dir)
+		return nil
+	}
+
+	span.SetAttributes(attribute.Int("kusto.files", len(paths)))
+
+	if cfg.DryRun {
+		for _, path := range paths {
+			format, ingestOptions, err := fileIngestOptions(cfg, path)
+			if err != nil {
+				return err
+			}
+			logger.Info("Dry run, skipping ingestion", "table", cfg.Table, "path", path, "format", format.String(), "options", optionNames(ingestOptions))
+		}
+		return nil
+	}
+
+	logger.Info("Replaying dead-letter directory...", "table", cfg.Table, "dir", dir, "files", len(paths))
+
+	// The files are already in the dead-letter directory, whose .err files are updated below.
+	cfg.DeadLetterDir = ""
+
+	files := make([]ManifestEntry, len(paths))
+	for i, path := range paths {
+		files[i] = ManifestEntry{Path: path, Table: cfg.Table}
+	}
+
+	// The errors updating the dead-letter directory are kept apart from the failed files.
+	var failed, bookkeeping []error
+	for i, ingestErr := range ingestFiles(ctx, ingestor, cfg, files) {
+		path := paths[i]
+		if ingestErr == nil {
+			logger.Info("Replayed file, removing it", "path", path)
+			if err := errors.Join(os.Remove(path), removeIfExists(path+deadLetterErrExt)); err != nil {
+				bookkeeping = append(bookkeeping, fmt.Errorf("file %q was replayed, but removing it failed: %w", path, err))
+			}
+			continue
+		}
+
+		failed = append(failed, ingestErr)
+		if err := updateDeadLetter(path, ingestErr); err != nil {
+			bookkeeping = append(bookkeeping, err)
+		}
+	}
+
+	if len(failed) > 0 {
+		err = fmt.Errorf("%d of %d files failed to replay: %w", len(failed), len(files), errors.Join(failed...))
+	}
+
+	return errors.Join(err, errors.Join(bookkeeping...))
+}
+
+// updateDeadLetter records ingestErr, the reason the replay of the dead-lettered file at path
+// failed. A file whose ingestion partly succeeded is renamed with the .partial extension, so
+// that it isn't replayed again, and a file whose ingestion may still complete is left as it is.
+func updateDeadLetter(path string, ingestErr error) error {
+	var ingestionErr *IngestionError
+	if errors.As(ingestErr, &ingestionErr) && ingestionErr.Partial() {
+		partial := path + deadLetterPartialExt
+		logger.Warn("Replay partly succeeded, setting the file aside so it isn't replayed again", "path", path, "partial", partial)
+		if err := os.Rename(path, partial); err != nil {
+			return fmt.Errorf("error setting aside partly replayed file %q: %w", path, err)
+		}
+		if err := errors.Join(writeDeadLetterReason(partial, ingestErr), removeIfExists(path+deadLetterErrExt)); err != nil {
+			return fmt.Errorf("error updating the reason of %q: %w", partial, err)
+		}
+		return nil
+	}
+
+	if !shouldDeadLetter(ingestErr) {
+		return nil
+	}
+	if err := writeDeadLetterReason(path, ingestErr); err != nil {
+		return fmt.Errorf("error updating %q: %w", path+deadLetterErrExt, err)
+	}
+
+	return nil
+}
+
+// deadLetterFiles returns the files in the dead-letter directory dir, other than .err and
+// .partial files, in lexical order.
+func deadLetterFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("dead-letter directory %q does not exist", dir)
+		}
+		return nil, fmt.Errorf("error reading dead-letter directory %q: %w", dir, err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.Type().IsRegular() || strings.EqualFold(ext, deadLetterErrExt) || strings.EqualFold(ext, deadLetterPartialExt) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+
+	return paths, nil
+}
+
+// removeIfExists removes the file at path, if there is one.
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+// failingIngestor fails the ingestion of the files whose names are in fail with the error
+// they map to.
+type failingIngestor struct {
+	fakeIngestor
+	fail map[string]error
+}
+
+func (f *failingIngestor) FromFile(ctx context.Context, fPath string, options ...azkustoingest.FileOption) (*azkustoingest.Result, error) {
+	result, err := f.fakeIngestor.FromFile(ctx, fPath, options...)
+	if failErr := f.fail[filepath.Base(fPath)]; failErr != nil {
+		return nil, failErr
+	}
+	return result, err
+}
+
+// dirContents returns the names and contents of the files in dir.
+func dirContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[entry.Name()] = string(data)
+	}
+
+	return contents
+}
+
+func TestDeadLetter(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		// want are the files in the dead-letter directory, other than .err files.
+		want []string
+	}{
+		{
+			name: "ingested",
+		},
+		{
+			name: "failed",
+			err:  errors.New("upload failed"),
+			want: []string{"data.csv"},
+		},
+		{
+			name: "ingestion failed",
+			err:  &IngestionError{Source: "data.csv", Status: azkustoingest.Failed, FailureStatus: azkustoingest.Permanent},
+			want: []string{"data.csv"},
+		},
+		{
+			name: "partly succeeded",
+			err:  &IngestionError{Source: "data.csv", Status: azkustoingest.PartiallySucceeded},
+		},
+		{
+			name: "interrupted",
+			err:  context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.csv")
+			if err := os.WriteFile(path, []byte("a,b\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := testConfig()
+			cfg.DeadLetterDir = filepath.Join(t.TempDir(), "dead")
+			ingestor := &fakeIngestor{err: tt.err}
+			err := IngestFile(context.Background(), ingestor, cfg, path)
+			if (err != nil) != (tt.err != nil) {
+				t.Fatalf("IngestFile() error = %v, want %v", err, tt.err)
+			}
+
+			var got []string
+			if contents, err := os.ReadDir(cfg.DeadLetterDir); err == nil {
+				for _, entry := range contents {
+					if !strings.HasSuffix(entry.Name(), deadLetterErrExt) {
+						got = append(got, entry.Name())
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("dead-letter directory has %v, want %v", got, tt.want)
+			}
+
+			if len(tt.want) > 0 {
+				got := dirContents(t, cfg.DeadLetterDir)
+				if got["data.csv"] != "a,b\n" {
+					t.Errorf("dead-letter copy = %q, want %q", got["data.csv"], "a,b\n")
+				}
+				if reason := got["data.csv"+deadLetterErrExt]; reason != err.Error()+"\n" {
+					t.Errorf("dead-letter reason = %q, want %q", reason, err.Error()+"\n")
+				}
+			}
+		})
+	}
+}
+
+func TestDeadLetterDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.csv", "b.csv", "sub/a.csv"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.DeadLetterDir = filepath.Join(t.TempDir(), "dead")
+	cfg.Concurrency = 1
+	ingestor := &failingIngestor{fail: map[string]error{"a.csv": errors.New("upload failed")}}
+	if err := IngestDirectory(context.Background(), ingestor, cfg, dir, "*.csv", true); err == nil {
+		t.Fatal("IngestDirectory() error = nil, want the failures")
+	}
+
+	// Both files named a.csv are kept, the second under a numbered name.
+	got := dirContents(t, cfg.DeadLetterDir)
+	var names []string
+	for name := range got {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"a-1.csv", "a-1.csv.err", "a.csv", "a.csv.err"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("dead-letter directory has %v, want %v", names, want)
+	}
+	if contents := got["a.csv"] + got["a-1.csv"]; contents != "a.csv\nsub/a.csv\n" && contents != "sub/a.csv\na.csv\n" {
+		t.Errorf("dead-letter files hold %q, want the failed files", contents)
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantStem string
+		wantExt  string
+	}{
+		{name: "data.csv", wantStem: "data", wantExt: ".csv"},
+		{name: "data.csv.gz", wantStem: "data", wantExt: ".csv.gz"},
+		{name: "data", wantStem: "data", wantExt: ""},
+		{name: ".hidden", wantStem: ".hidden", wantExt: ""},
+		{name: ".hidden.csv", wantStem: ".hidden", wantExt: ".csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stem, ext := splitName(tt.name)
+			if stem != tt.wantStem || ext != tt.wantExt {
+				t.Errorf("splitName(%q) = %q, %q, want %q, %q", tt.name, stem, ext, tt.wantStem, tt.wantExt)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ok.csv":      "a,b\n",
+		"ok.csv.err":  "upload failed\n",
+		"bad.csv":     "c,d\n",
+		"bad.csv.err": "first failure\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.Concurrency = 1
+	// Replayed files are never copied again, even to another dead-letter directory.
+	cfg.DeadLetterDir = filepath.Join(t.TempDir(), "dead")
+	ingestor := &failingIngestor{fail: map[string]error{"bad.csv": errors.New("upload failed")}}
+	err := Replay(context.Background(), ingestor, cfg, dir)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 files failed to replay") {
+		t.Fatalf("Replay() error = %v, want 1 of 2 files failed", err)
+	}
+	if !errors.Is(err, ErrIngest) {
+		t.Errorf("Replay() error = %v, want ErrIngest", err)
+	}
+
+	if len(ingestor.paths) != 2 {
+		t.Errorf("Replay() ingested %v, want bad.csv and ok.csv", ingestor.paths)
+	}
+
+	// The replayed file is removed, and the reason of the other is updated.
+	got := dirContents(t, dir)
+	if len(got) != 2 || got["bad.csv"] != "c,d\n" || got["bad.csv.err"] == "first failure\n" || !strings.Contains(got["bad.csv.err"], "upload failed") {
+		t.Errorf("dead-letter directory = %q, want bad.csv and its updated reason only", got)
+	}
+	if _, err := os.Stat(cfg.DeadLetterDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Replay() copied files to %q, want no copies", cfg.DeadLetterDir)
+	}
+}
+
+func TestReplayPartialSuccess(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{"data.csv": "a,b\n", "data.csv.err": "upload failed\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testConfig()
+	partial := &IngestionError{Source: "data.csv", Status: azkustoingest.PartiallySucceeded, Details: "1 record dropped"}
+	ingestor := &failingIngestor{fail: map[string]error{"data.csv": partial}}
+	err := Replay(context.Background(), ingestor, cfg, dir)
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 files failed to replay") {
+		t.Fatalf("Replay() error = %v, want 1 of 1 files failed", err)
+	}
+
+	got := dirContents(t, dir)
+	want := []string{"data.csv.partial", "data.csv.partial.err"}
+	var names []string
+	for name := range got {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("dead-letter directory has %v, want %v", names, want)
+	}
+	if reason := got["data.csv.partial.err"]; !strings.Contains(reason, "1 record dropped") {
+		t.Errorf("partial reason = %q, want the partial failure", reason)
+	}
+
+	// The partly ingested file isn't replayed again.
+	if err := Replay(context.Background(), ingestor, cfg, dir); err != nil {
+		t.Fatalf("second Replay() error = %v", err)
+	}
+	if len(ingestor.paths) != 1 {
+		t.Errorf("Replay() ingested %v, want data.csv once", ingestor.paths)
+	}
+}
+
+func TestReplayIdempotencyKey(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.csv", "b.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.IdempotencyKey = "batch-1"
+	ingestor := &fakeIngestor{}
+	if err := Replay(context.Background(), ingestor, cfg, dir); err == nil || !strings.Contains(err.Error(), "fixed idempotency key") {
+		t.Fatalf("Replay() error = %v, want the fixed key refused", err)
+	}
+	if len(ingestor.paths) != 0 || len(dirContents(t, dir)) != 2 {
+		t.Errorf("Replay() ingested %v, want nothing ingested or removed", ingestor.paths)
+	}
+
+	cfg.IdempotencyKey = AutoIdempotencyKey
+	if err := Replay(context.Background(), ingestor, cfg, dir); err != nil {
+		t.Fatalf("Replay() with %s error = %v", AutoIdempotencyKey, err)
+	}
+}
+
+func TestReplayMissingDirectory(t *testing.T) {
+	err := Replay(context.Background(), &fakeIngestor{}, testConfig(), filepath.Join(t.TempDir(), "missing"))
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Replay() error = %v, want the directory not to exist", err)
+	}
+}
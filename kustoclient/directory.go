@@ -0,0 +1,184 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultPattern is the glob pattern used to pick the files to ingest from a directory
+// when none is configured.
+const DefaultPattern = "*.csv"
+
+// IngestDirectory ingests every file in dir whose name matches the glob pattern into the
+// configured table, descending into subdirectories when recursive is set. Each file is
+// ingested as IngestFile would, up to cfg.Concurrency at a time, and one failing file doesn't
+// stop the others. The failures are returned together as a single error naming each file.
+func IngestDirectory(ctx context.Context, ingestor Ingestor, cfg Config, dir, pattern string, recursive bool) (err error) {
+	ctx, span := startSpan(ctx, "IngestDirectory", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	paths, err := matchingFiles(dir, pattern, recursive)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("kusto.files", len(paths)))
+
+	if cfg.DryRun {
+		for _, path := range paths {
+			format, ingestOptions, err := fileIngestOptions(cfg, path)
+			if err != nil {
+				return err
+			}
+			logger.Info("Dry run, skipping ingestion", "table", cfg.Table, "path", path, "format", format.String(), "options", optionNames(ingestOptions))
+		}
+		return nil
+	}
+
+	logger.Info("Ingesting directory...", "table", cfg.Table, "dir", dir, "pattern", pattern, "files", len(paths))
+
+	files := make([]ManifestEntry, len(paths))
+	for i, path := range paths {
+		files[i] = ManifestEntry{Path: path, Table: cfg.Table}
+	}
+
+	return ingestDirectory(ctx, ingestor, cfg, files)
+}
+
+// ingestDirectory ingests files into their tables with ingestor and waits for them to complete,
+// as ingestFiles does, and returns the failures together as a single error.
+func ingestDirectory(ctx context.Context, ingestor Ingestor, cfg Config, files []ManifestEntry) error {
+	var failed []error
+	for _, err := range ingestFiles(ctx, ingestor, cfg, files) {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed to ingest: %w", len(failed), len(files), errors.Join(failed...))
+	}
+
+	return nil
+}
+
+// ingestFiles ingests files into their tables with ingestor and waits for them to complete,
+// working on up to cfg.Concurrency files at a time (runtime.NumCPU() if unset), and returns
+// the error of each file, nil for those that were ingested. Once ctx is done no more files
+// are started.
+func ingestFiles(ctx context.Context, ingestor Ingestor, cfg Config, files []ManifestEntry) []error {
+	concurrency := cfg.Concurrency
+	if concurrency == 0 {
+		concurrency = runtime.NumCPU()
+	}
+	concurrency = min(concurrency, len(files))
+
+	// Each worker only writes the errors of the files it took, so no locking is needed.
+	errs := make([]error, len(files))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = ingestDirectoryFile(ctx, ingestor, cfg, files[i])
+			}
+		}()
+	}
+
+	for i := range files {
+		if ctx.Err() != nil {
+			errs[i] = fmt.Errorf("file %q not ingested: %w", files[i].Path, ctx.Err())
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return errs
+}
+
+// ingestDirectoryFile ingests file into its table with ingestor and waits for it to complete.
+func ingestDirectoryFile(ctx context.Context, ingestor Ingestor, cfg Config, file ManifestEntry) error {
+	_, ingestOptions, err := manifestIngestOptions(cfg, file)
+	if err != nil {
+		return err
+	}
+	if file.Table != cfg.Table {
+		// A replay ingests into the configured table, which this file doesn't go into.
+		cfg.DeadLetterDir = ""
+	}
+	cfg.Table = file.Table
+
+	logger.Info("Ingesting file...", "table", cfg.Table, "path", file.Path)
+	err = trackIngestion(func() error {
+		return ingestAndWait(ctx, cfg, file.Path, func() (*azkustoingest.Result, error) {
+			return ingestFromFile(ctx, ingestor, cfg, file.Path, ingestOptions)
+		})
+	})
+
+	return deadLetter(cfg, file.Path, err)
+}
+
+// matchingFiles returns the files in dir whose names match the glob pattern, in lexical order.
+// Subdirectories are only searched when recursive is set.
+func matchingFiles(dir, pattern string, recursive bool) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("directory %q does not exist", dir)
+		}
+		return nil, fmt.Errorf("error reading directory %q: %w", dir, err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%q is not a directory", dir)
+	}
+
+	var paths []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		// The pattern was checked above, so Match can't fail.
+		if ok, _ := filepath.Match(pattern, d.Name()); ok {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %q: %w", dir, err)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files matching %q in directory %q", pattern, dir)
+	}
+
+	return paths, nil
+}
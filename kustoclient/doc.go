@@ -0,0 +1,6 @@
+// Package kustoclient ingests data into and queries data from an Azure Data Explorer (Kusto) cluster.
+//
+// A Config describes the target cluster, database, table and authentication mechanism.
+// Connect turns it into a connection string, which is then used by Ingest, IngestFile and
+// IngestReader to push data, and by NewQueryClient to create the client Query reads it back with.
+package kustoclient
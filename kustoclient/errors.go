@@ -0,0 +1,44 @@
+package kustoclient
+
+import "errors"
+
+// Errors returned by the package wrap one of these, so that callers can tell which kind of
+// operation failed with errors.Is.
+var (
+	// ErrConfig is wrapped by the errors of Config.Validate.
+	ErrConfig = errors.New("invalid config")
+
+	// ErrAuth is wrapped by the errors of Connect.
+	ErrAuth = errors.New("authentication failed")
+
+	// ErrIngest is wrapped by the errors of the ingest functions, Follow, Verify and WaitPending.
+	ErrIngest = errors.New("ingestion failed")
+
+	// ErrQuery is wrapped by the errors of the functions running queries and management
+	// commands: Query, Count, Command, Check, Ping, CheckTable and CreateTable.
+	ErrQuery = errors.New("query failed")
+)
+
+// categorizedError is an error that also wraps the sentinel of its category, without the
+// category being added to its message.
+type categorizedError struct {
+	err      error
+	category error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() []error {
+	return []error{e.err, e.category}
+}
+
+// categorize returns err wrapping category as well, unless it already does.
+func categorize(category, err error) error {
+	if err == nil || errors.Is(err, category) {
+		return err
+	}
+
+	return &categorizedError{err: err, category: category}
+}
@@ -0,0 +1,107 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorCategories(t *testing.T) {
+	categories := []error{ErrConfig, ErrAuth, ErrIngest, ErrQuery}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T) error
+		want error
+	}{
+		{
+			name: "invalid config",
+			run: func(t *testing.T) error {
+				cfg := testConfig()
+				cfg.Database = ""
+				return cfg.Validate()
+			},
+			want: ErrConfig,
+		},
+		{
+			name: "service principal without credentials",
+			run: func(t *testing.T) error {
+				for _, name := range []string{"AZURE_CLIENT_ID", "AZURE_TENANT_ID", "AZURE_CLIENT_SECRET"} {
+					t.Setenv(name, "")
+				}
+				cfg := testConfig()
+				cfg.AuthType = ServicePrincipal
+				_, err := Connect(context.Background(), cfg)
+				return err
+			},
+			want: ErrAuth,
+		},
+		{
+			name: "missing file",
+			run: func(t *testing.T) error {
+				path := filepath.Join(t.TempDir(), "missing.csv")
+				return IngestFile(context.Background(), &fakeIngestor{}, testConfig(), path)
+			},
+			want: ErrIngest,
+		},
+		{
+			name: "failed ingestion",
+			run: func(t *testing.T) error {
+				_, err := Ingest(context.Background(), &fakeIngestor{err: errors.New("unavailable")}, testConfig())
+				return err
+			},
+			want: ErrIngest,
+		},
+		{
+			name: "failed query",
+			run: func(t *testing.T) error {
+				return Query(context.Background(), &fakeQuerier{}, testConfig())
+			},
+			want: ErrQuery,
+		},
+		{
+			name: "failed management command",
+			run: func(t *testing.T) error {
+				return CreateTable(context.Background(), &fakeQuerier{}, testConfig(), []TableColumn{{Name: "Name", Type: "string"}})
+			},
+			want: ErrQuery,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(t)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+
+			for _, category := range categories {
+				if got, want := errors.Is(err, category), category == tt.want; got != want {
+					t.Errorf("errors.Is(%q, %v) = %v, want %v", err, category, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	if err := categorize(ErrIngest, nil); err != nil {
+		t.Errorf("categorize(nil) = %v, want nil", err)
+	}
+
+	cause := &IngestionError{Source: "data.csv", Status: "Failed"}
+	err := categorize(ErrIngest, cause)
+	if err.Error() != cause.Error() {
+		t.Errorf("message = %q, want %q", err, cause)
+	}
+
+	var ingestionErr *IngestionError
+	if !errors.As(err, &ingestionErr) || ingestionErr != cause {
+		t.Errorf("errors.As didn't find the wrapped *IngestionError in %v", err)
+	}
+
+	if again := categorize(ErrIngest, err); again != err {
+		t.Errorf("categorizing again = %#v, want the same error", again)
+	}
+}
@@ -0,0 +1,194 @@
+package kustoclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultFollowInterval is how often Follow ingests the lines appended to the file
+	// when no interval is configured.
+	DefaultFollowInterval = 10 * time.Second
+
+	// DefaultFollowBatchSize is how many bytes of appended lines Follow buffers before
+	// ingesting them early, when no size is configured.
+	DefaultFollowBatchSize = 1 << 20
+
+	// followPollInterval is the longest Follow goes between checks for appended lines.
+	followPollInterval = time.Second
+
+	// followFlushTimeout is how long Follow has to ingest its buffered lines once ctx is done.
+	followFlushTimeout = time.Minute
+)
+
+// Follow tails the file at path, ingesting the lines appended to it after Follow starts.
+// Complete lines are buffered and ingested with IngestReader every interval, or as soon as
+// batchSize bytes are buffered. A file that shrinks is taken to be truncated and read again
+// from the start, and a file replaced at path, as by log rotation, is read to its end before
+// the new file is followed from its start. Follow returns once ctx is done, after ingesting
+// any buffered lines.
+func Follow(ctx context.Context, ingestor Ingestor, cfg Config, path string, interval time.Duration, batchSize int) (err error) {
+	defer func() { err = categorize(ErrIngest, err) }()
+
+	if interval <= 0 {
+		interval = DefaultFollowInterval
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultFollowBatchSize
+	}
+
+	t, err := newTail(path)
+	if err != nil {
+		return err
+	}
+	defer func() { t.f.Close() }()
+
+	logger.Info("Following file...", "table", cfg.Table, "path", path, "interval", interval.String())
+
+	// Only lines appended after Follow starts are read, the header of the file never is,
+	// and only complete lines are, so there is no incomplete last record to drop.
+	cfg.SkipHeader = false
+	cfg.IgnoreLastRecord = false
+
+	var batch bytes.Buffer
+	flush := func(ctx context.Context) error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		defer batch.Reset()
+
+		logger.Info("Ingesting appended lines...", "table", cfg.Table, "path", path, "bytes", batch.Len())
+		return IngestReader(ctx, ingestor, cfg, bytes.NewReader(batch.Bytes()))
+	}
+
+	poll := time.NewTicker(min(interval, followPollInterval))
+	defer poll.Stop()
+	lastFlush := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if len(t.partial) > 0 {
+				logger.Warn("Dropping incomplete last line", "path", path, "bytes", len(t.partial))
+			}
+
+			// ctx is done, give the last batch its own time to be ingested.
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), followFlushTimeout)
+			defer cancel()
+			return flush(flushCtx)
+		case <-poll.C:
+		}
+
+		lines, err := t.read()
+		if err != nil {
+			return err
+		}
+		batch.Write(lines)
+
+		if batch.Len() >= batchSize || time.Since(lastFlush) >= interval {
+			if err := flush(ctx); err != nil {
+				return err
+			}
+			lastFlush = time.Now()
+		}
+	}
+}
+
+// tail reads the lines appended to a file, following it through truncation and rotation.
+type tail struct {
+	path string
+	f    *os.File
+	info os.FileInfo
+
+	// offset is how far into f has been read.
+	offset int64
+
+	// partial is the start of a line whose end hasn't been written yet.
+	partial []byte
+}
+
+// newTail opens the file at path to read what is appended to it from now on.
+func newTail(path string) (*tail, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file to follow: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error reading file %q: %w", path, err)
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("file %q is a directory", path)
+	}
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error seeking to the end of %q: %w", path, err)
+	}
+
+	return &tail{path: path, f: f, info: info, offset: offset}, nil
+}
+
+// read returns the complete lines appended since the last read.
+func (t *tail) read() ([]byte, error) {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		// Mid rotation there may briefly be no file at path, keep reading the old one.
+		info = t.info
+	}
+
+	var lines []byte
+	if !os.SameFile(info, t.info) {
+		// The file was rotated. Finish off the old file, then start on the new one.
+		rest, err := t.readAppended()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, rest...)
+
+		f, err := os.Open(t.path)
+		if err != nil {
+			return nil, fmt.Errorf("error reopening rotated file: %w", err)
+		}
+		t.f.Close()
+		logger.Info("File rotated, following the new file", "path", t.path)
+		t.f, t.info, t.offset, t.partial = f, info, 0, nil
+	} else if info.Size() < t.offset {
+		logger.Info("File truncated, following from its start", "path", t.path)
+		if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("error seeking to the start of %q: %w", t.path, err)
+		}
+		t.offset, t.partial = 0, nil
+	}
+
+	appended, err := t.readAppended()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(lines, appended...), nil
+}
+
+// readAppended reads t.f to its end and returns the lines completed by what was read.
+func (t *tail) readAppended() ([]byte, error) {
+	data, err := io.ReadAll(t.f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %q: %w", t.path, err)
+	}
+	t.offset += int64(len(data))
+
+	data = append(t.partial, data...)
+	end := bytes.LastIndexByte(data, '\n') + 1
+	t.partial = append([]byte(nil), data[end:]...)
+
+	return data[:end], nil
+}
@@ -0,0 +1,59 @@
+package kustoclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.csv")
+	if err := os.WriteFile(path, []byte("old,line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ingestor := &fakeIngestor{}
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, ingestor, testConfig(), path, 50*time.Millisecond, 1<<20)
+	}()
+
+	appendTo := func(data string) {
+		t.Helper()
+		// Give Follow time to open the file and read what is there before writing more.
+		time.Sleep(200 * time.Millisecond)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	appendTo("first,line\nsecond,")
+	appendTo("line\n")
+	time.Sleep(200 * time.Millisecond)
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendTo("after,truncation\npartial")
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Follow() error = %v", err)
+	}
+
+	got := strings.Join(ingestor.data, "")
+	if want := "first,line\nsecond,line\nafter,truncation\n"; got != want {
+		t.Errorf("Follow() ingested %q, want %q", got, want)
+	}
+}
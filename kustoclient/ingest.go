@@ -0,0 +1,613 @@
+package kustoclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+	"github.com/Azure/azure-kusto-go/azkustoingest/ingestoptions"
+)
+
+// IngestMode is the ingestion client used to ingest data.
+type IngestMode int
+
+const (
+	QueuedIngest    IngestMode = iota // Batches data through the ingestion service, with minutes of latency
+	StreamingIngest                   // Ingests directly through the streaming endpoint, with low latency
+	ManagedIngest                     // Streams, falling back to queued ingestion when streaming fails or the data is too large
+)
+
+// String returns the string representation of the IngestMode.
+func (m IngestMode) String() string {
+	switch m {
+	case QueuedIngest:
+		return "queued"
+	case StreamingIngest:
+		return "streaming"
+	case ManagedIngest:
+		return "managed"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseIngestMode maps a mode name (queued, streaming or managed) to its IngestMode.
+func ParseIngestMode(name string) (IngestMode, error) {
+	for _, m := range []IngestMode{QueuedIngest, StreamingIngest, ManagedIngest} {
+		if strings.EqualFold(name, m.String()) {
+			return m, nil
+		}
+	}
+
+	return QueuedIngest, fmt.Errorf("unsupported ingest mode %q, supported modes are: queued, streaming, managed", name)
+}
+
+// UnknownRowCount is the row count Ingest returns when the ingestion status isn't tracked,
+// so it can't tell whether the row was ingested.
+const UnknownRowCount int64 = -1
+
+// Ingest ingests a single row stamped with the current time into the configured table,
+// retrying transient failures up to cfg.MaxRetries times. The ingest command is uploaded
+// from a file in the OS temp directory, which is removed before Ingest returns.
+//
+// It returns the number of rows ingested, once the ingestion status reports success. Streaming
+// ingestion doesn't report a status, so it returns UnknownRowCount instead, and dry runs return 0.
+func Ingest(ctx context.Context, ingestor Ingestor, cfg Config) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "Ingest", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	// The inline row is ingested as KQL, which has no columns for a mapping to apply to.
+	if cfg.Mapping != "" || cfg.MappingJSON != "" {
+		return 0, fmt.Errorf("an ingestion mapping can't be used with inline ingestion, ingest a file or reader instead")
+	}
+
+	// Add a row to the ingestor.
+	ingestQuery := inlineIngestQuery(cfg.Table, time.Now().UTC())
+
+	if err := ingestInline(ctx, ingestor, cfg, ingestQuery); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case cfg.DryRun:
+		return 0, nil
+	case reportingOptions(cfg) == nil:
+		return UnknownRowCount, nil
+	default:
+		// The status record has no row count, but the command only has the one row.
+		return 1, nil
+	}
+}
+
+// ingestInline uploads the inline ingest command ingestQuery with ingestor, from a temp file
+// that is removed before it returns unless cfg.KeepSource is set, retrying transient failures
+// up to cfg.MaxRetries times.
+func ingestInline(ctx context.Context, ingestor Ingestor, cfg Config, ingestQuery string) error {
+	cfg, err := withIdempotencyKey(cfg, openBytes([]byte(ingestQuery)))
+	if err != nil {
+		return err
+	}
+
+	metaOptions, err := metadataOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	var ingestOptions []azkustoingest.FileOption
+	if !cfg.KeepSource {
+		ingestOptions = append(ingestOptions, azkustoingest.DeleteSource())
+	}
+	ingestOptions = append(ingestOptions, reportingOptions(cfg)...)
+	ingestOptions = append(ingestOptions, metaOptions...)
+
+	if cfg.DryRun {
+		logger.Info("Dry run, skipping ingestion", "table", cfg.Table, "query", ingestQuery, "options", optionNames(ingestOptions))
+		return nil
+	}
+
+	// Write to a unique file so concurrent runs don't ingest each other's query. DeleteSource
+	// only removes it once ingestion has started, so remove it here too.
+	queryFile, err := os.CreateTemp("", "ingest-*.kql")
+	if err != nil {
+		return fmt.Errorf("error creating ingest query file: %w", err)
+	}
+	if cfg.KeepSource {
+		logger.Info("Keeping ingest query file", "path", queryFile.Name())
+	} else {
+		defer os.Remove(queryFile.Name())
+	}
+
+	logger.Info("Writing ingest query...", "table", cfg.Table, "path", queryFile.Name(), "query", ingestQuery)
+	_, err = queryFile.WriteString(ingestQuery)
+	if closeErr := queryFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing ingest query to %q: %w", queryFile.Name(), err)
+	}
+
+	logger.Info("Running ingest query now...", "table", cfg.Table)
+
+	return trackIngestion(func() error {
+		return ingestAndWait(ctx, cfg, "ingest query", func() (*azkustoingest.Result, error) {
+			var status *azkustoingest.Result
+			err := withRetry(ctx, "ingest", cfg.MaxRetries, func() error {
+				var err error
+				logger.Debug("Submitting ingestion", "source", queryFile.Name(), "options", optionNames(ingestOptions))
+				status, err = ingestor.FromFile(ctx, queryFile.Name(), ingestOptions...)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error ingesting data: %w", streamingError(cfg, err))
+			}
+
+			return status, nil
+		})
+	})
+}
+
+// inlineIngestQuery returns the command ingesting a single row stamped with t into table.
+func inlineIngestQuery(table string, t time.Time) string {
+	// Kusto Cluster has the following (by default):
+	// - ArcSqlTelemetry database name
+	// - ravpateTable table name
+	// - ravpateTable has: Timestamp, FirstName, LastName as columns
+	// Getting the current time and ingesting that into the table to test we have gotten it.
+	return fmt.Sprintf(`.ingest inline into table %s <| %s,Sql,Isgood`, table, t.Format(time.RFC3339))
+}
+
+// Ingestor uploads data to be ingested. The queued, streaming and managed clients
+// of azkustoingest all implement it. The ingestion options depend on cfg.IngestMode,
+// so the ingest functions should be given the client NewIngestor creates for the same cfg.
+type Ingestor interface {
+	FromFile(ctx context.Context, fPath string, options ...azkustoingest.FileOption) (*azkustoingest.Result, error)
+	FromReader(ctx context.Context, reader io.Reader, options ...azkustoingest.FileOption) (*azkustoingest.Result, error)
+}
+
+// NewIngestor creates the ingestion client selected by cfg.IngestMode, ingesting into the
+// configured database and table by default. Whichever client it returns, the caller must Close it.
+func NewIngestor(kcsb *azkustodata.ConnectionStringBuilder, cfg Config) (azkustoingest.Ingestor, error) {
+	options := []azkustoingest.Option{
+		azkustoingest.WithDefaultDatabase(cfg.IngestDB()),
+		azkustoingest.WithDefaultTable(cfg.Table),
+	}
+
+	switch cfg.IngestMode {
+	case QueuedIngest:
+		ingestor, err := azkustoingest.New(kcsb, options...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating ingestor: %w", err)
+		}
+		return ingestor, nil
+	case StreamingIngest:
+		ingestor, err := azkustoingest.NewStreaming(kcsb, options...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating streaming ingestor: %w", err)
+		}
+		return ingestor, nil
+	case ManagedIngest:
+		ingestor, err := azkustoingest.NewManaged(kcsb, options...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating managed ingestor: %w", err)
+		}
+		return ingestor, nil
+	default:
+		return nil, fmt.Errorf("invalid ingest mode: %d", cfg.IngestMode)
+	}
+}
+
+// reportingOptions returns the options that flush the ingestion batch, unless
+// cfg.NoFlushImmediately is set, and report its status. Streaming ingestion doesn't batch and
+// completes synchronously, so neither applies to it, and the streaming client rejects both.
+// The managed client accepts them for its queued fallback.
+func reportingOptions(cfg Config) []azkustoingest.FileOption {
+	if cfg.IngestMode == StreamingIngest {
+		return nil
+	}
+
+	if cfg.NoFlushImmediately {
+		return []azkustoingest.FileOption{azkustoingest.ReportResultToTable()}
+	}
+
+	return []azkustoingest.FileOption{
+		azkustoingest.FlushImmediately(),
+		azkustoingest.ReportResultToTable(),
+	}
+}
+
+// streamingError explains the error returned when streaming ingestion isn't enabled on the table.
+func streamingError(cfg Config, err error) error {
+	if cfg.IngestMode != StreamingIngest || !strings.Contains(err.Error(), "StreamingIngestionPolicyNotEnabled") {
+		return err
+	}
+
+	return fmt.Errorf("streaming ingestion is not enabled on table %s, alter its streaming ingestion policy or use queued ingestion: %w", cfg.Table, err)
+}
+
+// fileFormats maps the accepted format names to their ingestion data formats.
+var fileFormats = map[string]azkustoingest.DataFormat{
+	"csv":       azkustoingest.CSV,
+	"tsv":       azkustoingest.TSV,
+	"psv":       azkustoingest.PSV,
+	"scsv":      azkustoingest.SCSV,
+	"sohsv":     azkustoingest.SOHSV,
+	"json":      azkustoingest.JSON,
+	"multijson": azkustoingest.MultiJSON,
+	"parquet":   azkustoingest.Parquet,
+	"avro":      azkustoingest.AVRO,
+}
+
+// parseFileFormat maps a format name to its ingestion data format.
+func parseFileFormat(name string) (azkustoingest.DataFormat, error) {
+	if f, ok := fileFormats[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+
+	return azkustoingest.DFUnknown, fmt.Errorf("unsupported format %q, supported formats are: %s, of which the delimited formats are: %s",
+		name, strings.Join(SupportedFormats(), ", "), strings.Join(DelimitedFormats(), ", "))
+}
+
+// SupportedFormats returns the names of the formats files, blobs and readers can be in, sorted.
+func SupportedFormats() []string {
+	supported := make([]string, 0, len(fileFormats))
+	for k := range fileFormats {
+		supported = append(supported, k)
+	}
+	sort.Strings(supported)
+
+	return supported
+}
+
+// DelimitedFormats returns the names of the delimited text formats among SupportedFormats,
+// such as csv, sorted.
+func DelimitedFormats() []string {
+	var delimited []string
+	for _, name := range SupportedFormats() {
+		if isDelimitedFormat(fileFormats[name]) {
+			delimited = append(delimited, name)
+		}
+	}
+
+	return delimited
+}
+
+// checkFormatExtension warns when the format set in cfg.Format disagrees with the
+// extension of path, as when a csv file is ingested with -format parquet.
+func checkFormatExtension(cfg Config, path string) {
+	if cfg.Format == "" {
+		return
+	}
+
+	_, uncompressed := fileCompression(path)
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(uncompressed)), ".")
+	if _, known := fileFormats[ext]; known && !strings.EqualFold(ext, cfg.Format) {
+		logger.Warn("Format doesn't match the file extension", "path", path, "format", cfg.Format, "extension", ext)
+	}
+}
+
+// isDelimitedFormat reports whether format is one of the delimited text formats, such as csv.
+func isDelimitedFormat(format azkustoingest.DataFormat) bool {
+	switch format {
+	case azkustoingest.CSV, azkustoingest.TSV, azkustoingest.PSV, azkustoingest.SCSV, azkustoingest.SOHSV:
+		return true
+	default:
+		return false
+	}
+}
+
+// headerOptions returns the option skipping the first record of data in format when
+// cfg.SkipHeader is set. Only delimited formats have a header record to skip.
+func headerOptions(cfg Config, format azkustoingest.DataFormat) ([]azkustoingest.FileOption, error) {
+	if !cfg.SkipHeader {
+		return nil, nil
+	}
+
+	if !isDelimitedFormat(format) {
+		return nil, fmt.Errorf("skip header doesn't apply to %s data, only to the delimited formats: %s", format, strings.Join(DelimitedFormats(), ", "))
+	}
+
+	if cfg.IngestMode == StreamingIngest {
+		return nil, fmt.Errorf("skip header can't be used with streaming ingestion, use queued or managed ingestion instead")
+	}
+
+	return []azkustoingest.FileOption{azkustoingest.IgnoreFirstRecord()}, nil
+}
+
+// isBinaryFormat reports whether format is a binary, self-describing format, Parquet or Avro.
+func isBinaryFormat(format azkustoingest.DataFormat) bool {
+	return format == azkustoingest.Parquet || format == azkustoingest.AVRO
+}
+
+// fileFormatOptions returns the ingestion options describing the given format and the optional
+// mapping, cfg.Mapping or cfg.MappingJSON.
+func fileFormatOptions(format azkustoingest.DataFormat, cfg Config) ([]azkustoingest.FileOption, error) {
+	if cfg.Mapping == "" && cfg.MappingJSON == "" {
+		if isBinaryFormat(format) {
+			// Kusto maps the file's columns to the table's by name, which is rarely what's wanted.
+			logger.Warn("Ingesting without a mapping, columns will be matched by name", "format", format.String())
+		}
+		return []azkustoingest.FileOption{azkustoingest.FileFormat(format)}, nil
+	}
+
+	if err := validateMapping(cfg); err != nil {
+		return nil, err
+	}
+
+	kind, err := mappingKind(format)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MappingJSON != "" {
+		return []azkustoingest.FileOption{azkustoingest.IngestionMapping(cfg.MappingJSON, kind)}, nil
+	}
+
+	return []azkustoingest.FileOption{azkustoingest.IngestionMappingRef(cfg.Mapping, kind)}, nil
+}
+
+// mappingKind returns the kind of ingestion mapping used with the given format.
+func mappingKind(format azkustoingest.DataFormat) (azkustoingest.DataFormat, error) {
+	// IngestionMappingRef and IngestionMapping also set the file format, and the SDK requires
+	// both to match.
+	// Multi-line JSON uses JSON mappings, so the two can't be expressed together.
+	if format == azkustoingest.MultiJSON {
+		return azkustoingest.DFUnknown, fmt.Errorf("an ingestion mapping can't be combined with the multijson format, use json instead")
+	}
+
+	if !format.IsValidMappingKind() {
+		return azkustoingest.DFUnknown, fmt.Errorf("the %s format doesn't support ingestion mappings", format)
+	}
+
+	return format, nil
+}
+
+// optionNames returns the names of the given ingestion options, for logging.
+func optionNames(opts []azkustoingest.FileOption) []string {
+	names := make([]string, len(opts))
+	for i, o := range opts {
+		names[i] = o.String()
+	}
+
+	return names
+}
+
+// IngestFile ingests the file at path into the configured table.
+// The file is uploaded as-is through ingestor, bypassing the inline KQL path.
+// Its format is cfg.Format, or inferred from the file extension when that is empty.
+// Transient failures are retried up to cfg.MaxRetries times.
+func IngestFile(ctx context.Context, ingestor Ingestor, cfg Config, path string) (err error) {
+	ctx, span := startSpan(ctx, "IngestFile", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	format, ingestOptions, err := fileIngestOptions(cfg, path)
+	if err != nil {
+		return err
+	}
+
+	if cfg.DryRun {
+		logger.Info("Dry run, skipping ingestion", "table", cfg.Table, "path", path, "format", format.String(), "options", optionNames(ingestOptions))
+		return nil
+	}
+
+	logger.Info("Ingesting file...", "table", cfg.Table, "path", path, "format", format.String())
+
+	err = trackIngestion(func() error {
+		return ingestAndWait(ctx, cfg, path, func() (*azkustoingest.Result, error) {
+			return ingestFromFile(ctx, ingestor, cfg, path, ingestOptions)
+		})
+	})
+
+	return deadLetter(cfg, path, err)
+}
+
+// fileIngestOptions checks that the file at path can be ingested, and returns its format
+// and the options to ingest it with.
+func fileIngestOptions(cfg Config, path string) (azkustoingest.DataFormat, []azkustoingest.FileOption, error) {
+	if err := checkCompression(path); err != nil {
+		return azkustoingest.DFUnknown, nil, err
+	}
+
+	formatName := cfg.Format
+	if formatName == "" {
+		// Go by the extension under any compression extension, as in data.csv.gz.
+		_, uncompressed := fileCompression(path)
+		formatName = strings.TrimPrefix(strings.ToLower(filepath.Ext(uncompressed)), ".")
+	}
+
+	format, err := parseFileFormat(formatName)
+	if err != nil {
+		return azkustoingest.DFUnknown, nil, err
+	}
+	checkFormatExtension(cfg, path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return azkustoingest.DFUnknown, nil, fmt.Errorf("file %q does not exist", path)
+		}
+		return azkustoingest.DFUnknown, nil, fmt.Errorf("error reading file %q: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return azkustoingest.DFUnknown, nil, fmt.Errorf("file %q is a directory", path)
+	}
+
+	if info.Size() == 0 {
+		return azkustoingest.DFUnknown, nil, fmt.Errorf("file %q is empty, nothing to ingest", path)
+	}
+
+	formatOptions, err := fileFormatOptions(format, cfg)
+	if err != nil {
+		return azkustoingest.DFUnknown, nil, err
+	}
+
+	headerOpts, err := headerOptions(cfg, format)
+	if err != nil {
+		return azkustoingest.DFUnknown, nil, err
+	}
+
+	open := openFile(path)
+	if cfg.IgnoreLastRecord {
+		if err := checkIgnoreLastRecord(cfg, format); err != nil {
+			return azkustoingest.DFUnknown, nil, err
+		}
+		// Compressed files would have to be decompressed to find their last record.
+		if c, _ := fileCompression(path); c != ingestoptions.CTNone {
+			return azkustoingest.DFUnknown, nil, fmt.Errorf("ignore last record can't be used with the compressed file %q", path)
+		}
+		open = openFileWithoutLastRecord(path)
+	}
+
+	cfg, err = withIdempotencyKey(cfg, open)
+	if err != nil {
+		return azkustoingest.DFUnknown, nil, err
+	}
+
+	metaOptions, err := metadataOptions(cfg)
+	if err != nil {
+		return azkustoingest.DFUnknown, nil, err
+	}
+
+	ingestOptions := append(formatOptions, headerOpts...)
+	ingestOptions = append(ingestOptions, reportingOptions(cfg)...)
+	return format, append(ingestOptions, metaOptions...), nil
+}
+
+// ingestFromFile uploads the file at path with ingestor, without its last record as described by
+// lastRecordSource, and compressed as described by compressedSource,
+// retrying transient failures up to cfg.MaxRetries times.
+func ingestFromFile(ctx context.Context, ingestor Ingestor, cfg Config, path string, ingestOptions []azkustoingest.FileOption) (*azkustoingest.Result, error) {
+	trimmed, trimCleanup, err := lastRecordSource(cfg, path)
+	defer trimCleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	source, compressionOptions, cleanup, err := compressedSource(cfg, trimmed)
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+	ingestOptions = append(ingestOptions[:len(ingestOptions):len(ingestOptions)], compressionOptions...)
+
+	var status *azkustoingest.Result
+	err = withRetry(ctx, "ingest", cfg.MaxRetries, func() error {
+		var err error
+		logger.Debug("Submitting ingestion", "source", source, "options", optionNames(ingestOptions))
+		status, err = ingestor.FromFile(ctx, source, ingestOptions...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error ingesting file %q: %w", path, streamingError(cfg, err))
+	}
+
+	return status, nil
+}
+
+// IngestReader ingests everything read from r into the configured table.
+// The data is in cfg.Format, or when that is empty, the format sniffed from its first few KB. It is buffered in memory
+// so that transient failures can be retried up to cfg.MaxRetries times.
+func IngestReader(ctx context.Context, ingestor Ingestor, cfg Config, r io.Reader) (err error) {
+	ctx, span := startSpan(ctx, "IngestReader", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	formatName := cfg.Format
+	if formatName == "" {
+		formatName, r, err = sniffFormat(r)
+		if err != nil {
+			return fmt.Errorf("error reading input: %w", err)
+		}
+		logger.Info("Detected input format", "format", formatName)
+	}
+
+	format, err := parseFileFormat(formatName)
+	if err != nil {
+		return err
+	}
+
+	if err := checkIgnoreLastRecord(cfg, format); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		logger.Info("Input is empty, nothing to ingest.", "table", cfg.Table)
+		return nil
+	}
+
+	data, err = dropLastRecord(cfg, data)
+	if err != nil {
+		return err
+	}
+
+	formatOptions, err := fileFormatOptions(format, cfg)
+	if err != nil {
+		return err
+	}
+
+	headerOpts, err := headerOptions(cfg, format)
+	if err != nil {
+		return err
+	}
+
+	cfg, err = withIdempotencyKey(cfg, openBytes(data))
+	if err != nil {
+		return err
+	}
+
+	metaOptions, err := metadataOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	ingestOptions := append(formatOptions, headerOpts...)
+	ingestOptions = append(ingestOptions, reportingOptions(cfg)...)
+	ingestOptions = append(ingestOptions, metaOptions...)
+
+	if cfg.DryRun {
+		logger.Info("Dry run, skipping ingestion", "table", cfg.Table, "bytes", len(data), "format", format.String(), "options", optionNames(ingestOptions))
+		return nil
+	}
+
+	logger.Info("Ingesting input...", "table", cfg.Table, "bytes", len(data), "format", format.String())
+
+	return trackIngestion(func() error {
+		return ingestAndWait(ctx, cfg, "input", func() (*azkustoingest.Result, error) {
+			var status *azkustoingest.Result
+			err := withRetry(ctx, "ingest", cfg.MaxRetries, func() error {
+				var err error
+				logger.Debug("Submitting ingestion", "source", "input", "bytes", len(data), "options", optionNames(ingestOptions))
+				status, err = ingestor.FromReader(ctx, bytes.NewReader(data), ingestOptions...)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error ingesting input: %w", streamingError(cfg, err))
+			}
+
+			return status, nil
+		})
+	})
+}
@@ -0,0 +1,549 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+// fakeIngestor records the calls made to it instead of ingesting anything.
+// FromFile records the contents of local files in data, as FromReader does.
+// It can be shared by concurrent ingestions.
+type fakeIngestor struct {
+	mu      sync.Mutex
+	paths   []string
+	data    []string
+	options [][]string
+
+	// err, if set, is returned by every FromFile call.
+	err error
+}
+
+func (f *fakeIngestor) FromFile(ctx context.Context, fPath string, options ...azkustoingest.FileOption) (*azkustoingest.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.paths = append(f.paths, fPath)
+	f.options = append(f.options, optionNames(options))
+	if data, err := os.ReadFile(fPath); err == nil {
+		f.data = append(f.data, string(data))
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &azkustoingest.Result{}, nil
+}
+
+func (f *fakeIngestor) FromReader(ctx context.Context, reader io.Reader, options ...azkustoingest.FileOption) (*azkustoingest.Result, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data = append(f.data, string(data))
+	f.options = append(f.options, optionNames(options))
+	return &azkustoingest.Result{}, nil
+}
+
+func testConfig() Config {
+	return Config{
+		ClusterURL: DefaultKustoURL,
+		Database:   DefaultDatabase,
+		Table:      DefaultTable,
+	}
+}
+
+func TestInlineIngestQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		time  time.Time
+		want  string
+	}{
+		{
+			name:  "default table",
+			table: DefaultTable,
+			time:  time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC),
+			want:  ".ingest inline into table ravpateTable <| 2024-06-01T12:30:45Z,Sql,Isgood",
+		},
+		{
+			name:  "fractional seconds are dropped",
+			table: "Events",
+			time:  time.Date(2023, 1, 2, 3, 4, 5, 999, time.UTC),
+			want:  ".ingest inline into table Events <| 2023-01-02T03:04:05Z,Sql,Isgood",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inlineIngestQuery(tt.table, tt.time); got != tt.want {
+				t.Errorf("inlineIngestQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngestRejectsMapping(t *testing.T) {
+	cfg := testConfig()
+	cfg.Mapping = "RowMapping"
+
+	ingestor := &fakeIngestor{}
+	_, err := Ingest(context.Background(), ingestor, cfg)
+	if err == nil || !strings.Contains(err.Error(), "mapping") {
+		t.Fatalf("Ingest() error = %v, want a mapping error", err)
+	}
+	if len(ingestor.paths) != 0 {
+		t.Errorf("Ingest() ingested %v, want nothing", ingestor.paths)
+	}
+}
+
+func TestIngestKeepSource(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep %v", keep), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.KeepSource = keep
+
+			ingestor := &fakeIngestor{}
+			if _, err := Ingest(context.Background(), ingestor, cfg); err != nil {
+				t.Fatalf("Ingest() error = %v", err)
+			}
+			if len(ingestor.paths) != 1 {
+				t.Fatalf("Ingest() ingested %v, want one query file", ingestor.paths)
+			}
+			path := ingestor.paths[0]
+			defer os.Remove(path)
+
+			if got := slices.Contains(ingestor.options[0], "DeleteSource"); got == keep {
+				t.Errorf("Ingest() options = %v, want DeleteSource %v", ingestor.options[0], !keep)
+			}
+			if _, err := os.Stat(path); (err == nil) != keep {
+				t.Errorf("query file exists = %v, want %v", err == nil, keep)
+			}
+		})
+	}
+}
+
+func TestIngestQueryFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     IngestMode
+		err      error
+		wantRows int64
+		wantErr  bool
+	}{
+		{name: "ingested", wantRows: 1},
+		{name: "streaming has no status", mode: StreamingIngest, wantRows: UnknownRowCount},
+		{name: "ingestion fails", err: errors.New("ingestion rejected"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+
+			cfg := testConfig()
+			cfg.IngestMode = tt.mode
+
+			ingestor := &fakeIngestor{err: tt.err}
+			rows, err := Ingest(context.Background(), ingestor, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Ingest() error = %v, want error %v", err, tt.wantErr)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("Ingest() rows = %d, want %d", rows, tt.wantRows)
+			}
+
+			if len(ingestor.paths) != 1 || filepath.Dir(ingestor.paths[0]) != tmp {
+				t.Fatalf("Ingest() ingested %v, want one file in %s", ingestor.paths, tmp)
+			}
+			if len(ingestor.data) != 1 || !strings.HasPrefix(ingestor.data[0], ".ingest inline into table "+DefaultTable) {
+				t.Errorf("Ingest() ingested %q, want the inline ingest query", ingestor.data)
+			}
+
+			entries, err := os.ReadDir(tmp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Ingest() left %d files in the temp directory, want none", len(entries))
+			}
+		})
+	}
+}
+
+func TestIngestFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		cfg         func(*Config)
+		wantOptions []string
+		wantErr     string
+	}{
+		{
+			name:        "csv",
+			file:        "data.csv",
+			content:     "a,b\n",
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "format overrides extension",
+			file:        "data.txt",
+			content:     `{"a":1}`,
+			cfg:         func(c *Config) { c.Format = "json" },
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "mapping",
+			file:        "data.json",
+			content:     `{"a":1}`,
+			cfg:         func(c *Config) { c.Mapping = "JsonMapping" },
+			wantOptions: []string{"IngestionMappingRef", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "inline mapping",
+			file:        "data.json",
+			content:     `{"a":1}`,
+			cfg:         func(c *Config) { c.MappingJSON = `[{"column":"A","Properties":{"Path":"$.a"}}]` },
+			wantOptions: []string{"IngestionMapping", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "parquet",
+			file:        "data.parquet",
+			content:     "PAR1",
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "avro with mapping",
+			file:        "data.avro",
+			content:     "Obj\x01",
+			cfg:         func(c *Config) { c.Mapping = "AvroMapping" },
+			wantOptions: []string{"IngestionMappingRef", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "format disagreeing with the extension",
+			file:        "data.csv",
+			content:     "PAR1",
+			cfg:         func(c *Config) { c.Format = "parquet" },
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "streaming drops reporting options",
+			file:        "data.csv",
+			content:     "a,b\n",
+			cfg:         func(c *Config) { c.IngestMode = StreamingIngest },
+			wantOptions: []string{"FileFormat"},
+		},
+		{
+			name:        "batched",
+			file:        "data.csv",
+			content:     "a,b\n",
+			cfg:         func(c *Config) { c.NoFlushImmediately = true },
+			wantOptions: []string{"FileFormat", "ReportResultToTable"},
+		},
+		{
+			name:        "gzipped",
+			file:        "data.csv.gz",
+			content:     "not really gzipped",
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "CompressionType"},
+		},
+		{
+			name:        "skip header",
+			file:        "data.csv",
+			content:     "a,b\n1,2\n",
+			cfg:         func(c *Config) { c.SkipHeader = true },
+			wantOptions: []string{"FileFormat", "IgnoreFirstRecord", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "skip header of tsv",
+			file:        "data.tsv",
+			content:     "a\tb\n1\t2\n",
+			cfg:         func(c *Config) { c.SkipHeader = true },
+			wantOptions: []string{"FileFormat", "IgnoreFirstRecord", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "skip header of sohsv",
+			file:        "data.sohsv",
+			content:     "a\x01b\n1\x012\n",
+			cfg:         func(c *Config) { c.SkipHeader = true },
+			wantOptions: []string{"FileFormat", "IgnoreFirstRecord", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:    "skip header of json",
+			file:    "data.json",
+			content: `{"a":1}`,
+			cfg:     func(c *Config) { c.SkipHeader = true },
+			wantErr: "skip header doesn't apply to json data",
+		},
+		{
+			name:    "skip header with streaming",
+			file:    "data.csv",
+			content: "a,b\n1,2\n",
+			cfg: func(c *Config) {
+				c.SkipHeader = true
+				c.IngestMode = StreamingIngest
+			},
+			wantErr: "streaming",
+		},
+		{
+			name:    "tags and creation time",
+			file:    "data.csv",
+			content: "a,b\n",
+			cfg: func(c *Config) {
+				c.Tags = []string{"ingest-by:batch-1", "drop-by:2024-06"}
+				c.CreationTime = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+			},
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "Tags", "SetCreationTime"},
+		},
+		{
+			name:    "ingest if not exists",
+			file:    "data.csv",
+			content: "a,b\n",
+			cfg: func(c *Config) {
+				c.Tags = []string{"ingest-by:batch-1"}
+				c.IngestIfNotExists = "batch-1"
+			},
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "Tags", "IfNotExists"},
+		},
+		{
+			name:        "idempotency key",
+			file:        "data.csv",
+			content:     "a,b\n",
+			cfg:         func(c *Config) { c.IdempotencyKey = "batch-1" },
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "Tags", "IfNotExists"},
+		},
+		{
+			name:        "automatic idempotency key",
+			file:        "data.csv",
+			content:     "a,b\n",
+			cfg:         func(c *Config) { c.IdempotencyKey = AutoIdempotencyKey },
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "Tags", "IfNotExists"},
+		},
+		{
+			name:        "ingestion properties",
+			file:        "data.csv",
+			content:     "a,b\n",
+			cfg:         func(c *Config) { c.Properties = map[string]string{"ignoreFirstRecord": "true", "zipPattern": "*.csv"} },
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "IgnoreFirstRecord"},
+		},
+		{
+			name:    "ingest if not exists without its tag",
+			file:    "data.csv",
+			content: "a,b\n",
+			cfg: func(c *Config) {
+				c.Tags = []string{"ingest-by:batch-2"}
+				c.IngestIfNotExists = "batch-1"
+			},
+			wantErr: `requires the "ingest-by:batch-1" tag`,
+		},
+		{
+			name:    "malformed tag",
+			file:    "data.csv",
+			content: "a,b\n",
+			cfg:     func(c *Config) { c.Tags = []string{"batch-1"} },
+			wantErr: "invalid tag",
+		},
+		{
+			name:    "empty tag value",
+			file:    "data.csv",
+			content: "a,b\n",
+			cfg:     func(c *Config) { c.Tags = []string{"drop-by:"} },
+			wantErr: "must not be empty",
+		},
+		{
+			name:    "streaming with tags",
+			file:    "data.csv",
+			content: "a,b\n",
+			cfg: func(c *Config) {
+				c.IngestMode = StreamingIngest
+				c.Tags = []string{"ingest-by:batch-1"}
+			},
+			wantErr: "streaming",
+		},
+		{
+			name:    "multijson with mapping",
+			file:    "data.json",
+			content: `[{"a":1}]`,
+			cfg: func(c *Config) {
+				c.Format = "multijson"
+				c.Mapping = "JsonMapping"
+			},
+			wantErr: "multijson",
+		},
+		{
+			name:    "inline mapping not JSON",
+			file:    "data.json",
+			content: `{"a":1}`,
+			cfg:     func(c *Config) { c.MappingJSON = "column:A" },
+			wantErr: "invalid mapping JSON",
+		},
+		{
+			name:    "inline mapping with mapping reference",
+			file:    "data.json",
+			content: `{"a":1}`,
+			cfg: func(c *Config) {
+				c.Mapping = "JsonMapping"
+				c.MappingJSON = `[{"column":"A","Properties":{"Path":"$.a"}}]`
+			},
+			wantErr: "can't be used together",
+		},
+		{
+			name:    "inline mapping with streaming",
+			file:    "data.json",
+			content: `{"a":1}`,
+			cfg: func(c *Config) {
+				c.IngestMode = StreamingIngest
+				c.MappingJSON = `[{"column":"A","Properties":{"Path":"$.a"}}]`
+			},
+			wantErr: "streaming",
+		},
+		{
+			name:    "unsupported extension",
+			file:    "data.xml",
+			content: "<a/>",
+			wantErr: "unsupported format",
+		},
+		{
+			name:    "unsupported format lists the delimited formats",
+			file:    "data.csv",
+			content: "a;b\n",
+			cfg:     func(c *Config) { c.Format = "ssv" },
+			wantErr: "the delimited formats are: csv, psv, scsv, sohsv, tsv",
+		},
+		{
+			name:    "empty file",
+			file:    "data.csv",
+			wantErr: "is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := testConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+
+			ingestor := &fakeIngestor{}
+			err := IngestFile(context.Background(), ingestor, cfg, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("IngestFile() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if len(ingestor.paths) != 0 {
+					t.Errorf("IngestFile() ingested %v, want nothing", ingestor.paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IngestFile() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(ingestor.paths, []string{path}) {
+				t.Errorf("IngestFile() ingested %v, want %v", ingestor.paths, []string{path})
+			}
+			if !reflect.DeepEqual(ingestor.options, [][]string{tt.wantOptions}) {
+				t.Errorf("IngestFile() options = %v, want %v", ingestor.options, tt.wantOptions)
+			}
+		})
+	}
+}
+
+func TestIngestFileDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte("a,b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.DryRun = true
+
+	ingestor := &fakeIngestor{}
+	if err := IngestFile(context.Background(), ingestor, cfg, path); err != nil {
+		t.Fatalf("IngestFile() error = %v", err)
+	}
+	if len(ingestor.paths) != 0 {
+		t.Errorf("IngestFile() ingested %v in a dry run, want nothing", ingestor.paths)
+	}
+}
+
+func TestIngestReader(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		cfg         func(*Config)
+		wantData    []string
+		wantOptions [][]string
+	}{
+		{
+			name:        "csv by default",
+			input:       "a,b\n",
+			wantData:    []string{"a,b\n"},
+			wantOptions: [][]string{{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		},
+		{
+			name:        "managed keeps reporting options",
+			input:       `{"a":1}`,
+			cfg:         func(c *Config) { c.Format = "json"; c.IngestMode = ManagedIngest },
+			wantData:    []string{`{"a":1}`},
+			wantOptions: [][]string{{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		},
+		{
+			name:        "ignore last record",
+			input:       "a,b\n1,2\n3,",
+			cfg:         func(c *Config) { c.IgnoreLastRecord = true },
+			wantData:    []string{"a,b\n1,2\n"},
+			wantOptions: [][]string{{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		},
+		{
+			name:  "empty input is skipped",
+			input: " \n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+
+			ingestor := &fakeIngestor{}
+			if err := IngestReader(context.Background(), ingestor, cfg, strings.NewReader(tt.input)); err != nil {
+				t.Fatalf("IngestReader() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(ingestor.data, tt.wantData) {
+				t.Errorf("IngestReader() ingested %q, want %q", ingestor.data, tt.wantData)
+			}
+			if !reflect.DeepEqual(ingestor.options, tt.wantOptions) {
+				t.Errorf("IngestReader() options = %v, want %v", ingestor.options, tt.wantOptions)
+			}
+		})
+	}
+}
+
+func TestDelimitedFormats(t *testing.T) {
+	if got, want := DelimitedFormats(), []string{"csv", "psv", "scsv", "sohsv", "tsv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DelimitedFormats() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,135 @@
+package kustoclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MaxInlineRows is the most rows IngestRows ingests with an inline ingest command. Inline
+// ingestion is meant for small batches, larger ones are ingested as CSV data instead.
+const MaxInlineRows = 100
+
+// IngestRows ingests rows, each a list of column values, into the configured table. Up to
+// MaxInlineRows rows are ingested with a single inline ingest command, and more than that
+// are ingested as CSV data with IngestReader, logging a warning. Transient failures are
+// retried up to cfg.MaxRetries times.
+func IngestRows(ctx context.Context, ingestor Ingestor, cfg Config, rows [][]string) (err error) {
+	ctx, span := startSpan(ctx, "IngestRows", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	if len(rows) == 0 {
+		logger.Info("No rows, nothing to ingest.", "table", cfg.Table)
+		return nil
+	}
+
+	if len(rows) > MaxInlineRows {
+		logger.Warn("Too many rows to ingest inline, ingesting them as CSV data instead", "table", cfg.Table, "rows", len(rows), "maxInlineRows", MaxInlineRows)
+
+		return ingestRows(ctx, ingestor, cfg, rows, "csv")
+	}
+
+	// The rows are ingested as KQL, which has no columns for a mapping to apply to.
+	if cfg.Mapping != "" || cfg.MappingJSON != "" {
+		return fmt.Errorf("an ingestion mapping can't be used with inline ingestion, ingest a file or reader instead")
+	}
+
+	ingestQuery, err := inlineRowsQuery(cfg.Table, rows)
+	if err != nil {
+		return err
+	}
+
+	return ingestInline(ctx, ingestor, cfg, ingestQuery)
+}
+
+// rowDelimiters maps the formats IngestRowsAs can encode rows in to their value separators.
+var rowDelimiters = map[string]rune{
+	"csv":   ',',
+	"tsv":   '\t',
+	"psv":   '|',
+	"scsv":  ';',
+	"sohsv": '\x01',
+}
+
+// IngestRowsAs ingests rows, each a list of column values, into the configured table as data
+// in format, one of csv, tsv, psv, scsv or sohsv. The rows are encoded in memory and ingested with
+// IngestReader, so no temporary file is written whatever their number. Transient failures are
+// retried up to cfg.MaxRetries times.
+func IngestRowsAs(ctx context.Context, ingestor Ingestor, cfg Config, rows [][]string, format string) (err error) {
+	ctx, span := startSpan(ctx, "IngestRowsAs", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	if len(rows) == 0 {
+		logger.Info("No rows, nothing to ingest.", "table", cfg.Table)
+		return nil
+	}
+
+	return ingestRows(ctx, ingestor, cfg, rows, format)
+}
+
+// ingestRows encodes rows in format and ingests them with IngestReader.
+func ingestRows(ctx context.Context, ingestor Ingestor, cfg Config, rows [][]string, format string) error {
+	format = strings.ToLower(format)
+	comma, ok := rowDelimiters[format]
+	if !ok {
+		return fmt.Errorf("rows can't be ingested as %q, use one of the delimited formats: %s", format, strings.Join(DelimitedFormats(), ", "))
+	}
+
+	var b bytes.Buffer
+	if err := encodeRows(&b, rows, comma); err != nil {
+		return err
+	}
+
+	rowsCfg := cfg
+	rowsCfg.Format = format
+	// The rows have no header record for Kusto to skip, nor an incomplete last record.
+	rowsCfg.SkipHeader = false
+	rowsCfg.IgnoreLastRecord = false
+	return IngestReader(ctx, ingestor, rowsCfg, &b)
+}
+
+// inlineRowsQuery returns the command ingesting rows into table, one CSV record per line.
+func inlineRowsQuery(table string, rows [][]string) (string, error) {
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no rows to ingest")
+	}
+
+	data, err := csvRows(rows)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(".ingest inline into table %s <|\n%s", table, strings.TrimSuffix(data, "\n")), nil
+}
+
+// csvRows encodes rows as CSV.
+func csvRows(rows [][]string) (string, error) {
+	var b bytes.Buffer
+	if err := encodeRows(&b, rows, ','); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// encodeRows writes rows to w as records of values separated by comma. Values containing
+// the separator, quotes or newlines are quoted, so that every value stays in its column
+// and every row in its record.
+func encodeRows(w io.Writer, rows [][]string, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("error encoding rows: %w", err)
+	}
+
+	return nil
+}
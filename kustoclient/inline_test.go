@@ -0,0 +1,153 @@
+package kustoclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestInlineRowsQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    [][]string
+		want    string
+		wantErr bool
+	}{
+		{name: "no rows", wantErr: true},
+		{
+			name: "one row",
+			rows: [][]string{{"2024-06-01T12:30:45Z", "Sql", "Isgood"}},
+			want: ".ingest inline into table Events <|\n2024-06-01T12:30:45Z,Sql,Isgood",
+		},
+		{
+			name: "many rows",
+			rows: [][]string{
+				{"2024-06-01T12:30:45Z", "Sql", "Isgood"},
+				{"2024-06-01T12:30:46Z", "with, comma", `with "quotes"`},
+				{"2024-06-01T12:30:47Z", "with\nnewline", ""},
+			},
+			want: ".ingest inline into table Events <|\n" +
+				"2024-06-01T12:30:45Z,Sql,Isgood\n" +
+				"2024-06-01T12:30:46Z,\"with, comma\",\"with \"\"quotes\"\"\"\n" +
+				"2024-06-01T12:30:47Z,\"with\nnewline\",",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inlineRowsQuery("Events", tt.rows)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inlineRowsQuery() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("inlineRowsQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngestRows(t *testing.T) {
+	manyRows := make([][]string, MaxInlineRows+1)
+	for i := range manyRows {
+		manyRows[i] = []string{fmt.Sprint(i), "Sql", "Isgood"}
+	}
+
+	tests := []struct {
+		name       string
+		rows       [][]string
+		wantCalls  int
+		wantInline bool
+	}{
+		{name: "zero rows"},
+		{name: "one row", rows: [][]string{{"1", "Sql", "Isgood"}}, wantCalls: 1, wantInline: true},
+		{name: "over the inline cap", rows: manyRows, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingestor := &fakeIngestor{}
+			if err := IngestRows(context.Background(), ingestor, testConfig(), tt.rows); err != nil {
+				t.Fatalf("IngestRows() error = %v", err)
+			}
+
+			if len(ingestor.data) != tt.wantCalls {
+				t.Fatalf("IngestRows() made %d ingestions, want %d", len(ingestor.data), tt.wantCalls)
+			}
+			if tt.wantCalls == 0 {
+				return
+			}
+
+			if inline := strings.HasPrefix(ingestor.data[0], ".ingest inline"); inline != tt.wantInline {
+				t.Errorf("IngestRows() ingested inline = %v, want %v", inline, tt.wantInline)
+			}
+			if !tt.wantInline && len(ingestor.paths) != 0 {
+				t.Errorf("IngestRows() ingested files %v, want data read from a reader", ingestor.paths)
+			}
+		})
+	}
+}
+
+func TestIngestRowsAs(t *testing.T) {
+	rows := [][]string{
+		{"1", "plain", "value"},
+		{"2", "has, comma", `has "quotes"`},
+		{"3", "has\ttab", "has|pipe;semicolon"},
+		{"4", "has\nnewline", ""},
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "csv",
+			format: "csv",
+			want:   "1,plain,value\n2,\"has, comma\",\"has \"\"quotes\"\"\"\n3,has\ttab,has|pipe;semicolon\n4,\"has\nnewline\",\n",
+		},
+		{
+			name:   "tsv",
+			format: "TSV",
+			want:   "1\tplain\tvalue\n2\thas, comma\t\"has \"\"quotes\"\"\"\n3\t\"has\ttab\"\thas|pipe;semicolon\n4\t\"has\nnewline\"\t\n",
+		},
+		{
+			name:   "psv",
+			format: "psv",
+			want:   "1|plain|value\n2|has, comma|\"has \"\"quotes\"\"\"\n3|has\ttab|\"has|pipe;semicolon\"\n4|\"has\nnewline\"|\n",
+		},
+		{
+			name:   "sohsv",
+			format: "sohsv",
+			want:   "1\x01plain\x01value\n2\x01has, comma\x01\"has \"\"quotes\"\"\"\n3\x01has\ttab\x01has|pipe;semicolon\n4\x01\"has\nnewline\"\x01\n",
+		},
+		{name: "unsupported format", format: "json", wantErr: `rows can't be ingested as "json"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingestor := &fakeIngestor{}
+			err := IngestRowsAs(context.Background(), ingestor, testConfig(), rows, tt.format)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("IngestRowsAs() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IngestRowsAs() error = %v", err)
+			}
+
+			if len(ingestor.data) != 1 {
+				t.Fatalf("IngestRowsAs() made %d ingestions, want 1", len(ingestor.data))
+			}
+			if len(ingestor.paths) != 0 {
+				t.Errorf("IngestRowsAs() ingested files %v, want data read from a reader", ingestor.paths)
+			}
+			if ingestor.data[0] != tt.want {
+				t.Errorf("IngestRowsAs() ingested %q, want %q", ingestor.data[0], tt.want)
+			}
+		})
+	}
+}
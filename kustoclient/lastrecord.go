@@ -0,0 +1,163 @@
+package kustoclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+// checkIgnoreLastRecord checks that the last record of data in format can be dropped when
+// cfg.IgnoreLastRecord is set. Only delimited formats have records to drop.
+func checkIgnoreLastRecord(cfg Config, format azkustoingest.DataFormat) error {
+	if !cfg.IgnoreLastRecord {
+		return nil
+	}
+
+	if !isDelimitedFormat(format) {
+		return fmt.Errorf("ignore last record doesn't apply to %s data, only to the delimited formats: %s", format, strings.Join(DelimitedFormats(), ", "))
+	}
+
+	return nil
+}
+
+// lastRecordOffset returns the offset in what is read from r at which its last record, or
+// line, starts. A newline ending the data doesn't start another record, so the data up to the
+// offset is everything but the last record, whether or not that has its newline yet.
+func lastRecordOffset(r io.Reader) (int64, error) {
+	var offset, lastNewline, prevNewline int64 = 0, -1, -1
+	var lastByte byte
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for i := 0; i < n; {
+			j := bytes.IndexByte(buf[i:n], '\n')
+			if j < 0 {
+				break
+			}
+			prevNewline, lastNewline = lastNewline, offset+int64(i+j)
+			i += j + 1
+		}
+		if n > 0 {
+			lastByte = buf[n-1]
+		}
+		offset += int64(n)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if offset > 0 && lastByte == '\n' {
+		return prevNewline + 1, nil
+	}
+
+	return lastNewline + 1, nil
+}
+
+// dropLastRecord returns data without its last record, when cfg.IgnoreLastRecord is set.
+func dropLastRecord(cfg Config, data []byte) ([]byte, error) {
+	if !cfg.IgnoreLastRecord {
+		return data, nil
+	}
+
+	offset, err := lastRecordOffset(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(data[:offset])) == 0 {
+		return nil, fmt.Errorf("input has a single record, nothing is left to ingest once the last is ignored")
+	}
+
+	return data[:offset], nil
+}
+
+// openFileWithoutLastRecord returns a function reading the file at path up to its last record,
+// for withIdempotencyKey to hash what is ingested of it.
+func openFileWithoutLastRecord(path string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		offset, err := fileLastRecordOffset(path)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(f, offset), f}, nil
+	}
+}
+
+// fileLastRecordOffset returns the offset at which the last record of the file at path starts.
+func fileLastRecordOffset(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return lastRecordOffset(f)
+}
+
+// lastRecordSource returns the path of the file to upload in place of the file at path when
+// cfg.IgnoreLastRecord is set: a temp copy of the file without its last record. Kusto has no
+// ingestion property for dropping it, as it has for the first. The returned cleanup func
+// removes the temp file, unless cfg.KeepSource is set, and must always be called, including
+// when an error is returned.
+func lastRecordSource(cfg Config, path string) (string, func(), error) {
+	noop := func() {}
+
+	if !cfg.IgnoreLastRecord {
+		return path, noop, nil
+	}
+
+	offset, err := fileLastRecordOffset(path)
+	if err != nil {
+		return "", noop, fmt.Errorf("error reading file %q: %w", path, err)
+	}
+	if offset == 0 {
+		return "", noop, fmt.Errorf("file %q has a single record, nothing is left to ingest once the last is ignored", path)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", noop, fmt.Errorf("error reading file %q: %w", path, err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "kusto-ingest-*"+filepath.Ext(path))
+	if err != nil {
+		return "", noop, fmt.Errorf("error creating temp file to drop the last record of %q: %w", path, err)
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+
+	_, err = io.CopyN(tmp, src, offset)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("error dropping the last record of %q: %w", path, err)
+	}
+
+	if cfg.KeepSource {
+		logger.Info("Keeping file without its last record", "path", path, "trimmed", tmp.Name())
+		cleanup = noop
+	}
+
+	return tmp.Name(), cleanup, nil
+}
@@ -0,0 +1,143 @@
+package kustoclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLastRecordOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int64
+	}{
+		{name: "incomplete last record", data: "a,b\n1,2\n3,", want: 8},
+		{name: "complete last record", data: "a,b\n1,2\n", want: 4},
+		{name: "crlf", data: "a,b\r\n1,2\r\n", want: 5},
+		{name: "single record", data: "a,b\n"},
+		{name: "single incomplete record", data: "a,"},
+		{name: "empty"},
+		{name: "longer than the read buffer", data: strings.Repeat("x", 40000) + "\n" + strings.Repeat("y", 40000), want: 40001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lastRecordOffset(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("lastRecordOffset() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("lastRecordOffset() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngestFileIgnoreLastRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		cfg         func(*Config)
+		wantData    string
+		wantOptions []string
+		wantErr     string
+	}{
+		{
+			name:        "incomplete last record",
+			file:        "data.csv",
+			content:     "a,b\n1,2\n3,",
+			wantData:    "a,b\n1,2\n",
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "with skip header",
+			file:        "data.tsv",
+			content:     "a\tb\n1\t2\nfooter\n",
+			cfg:         func(c *Config) { c.SkipHeader = true },
+			wantData:    "a\tb\n1\t2\n",
+			wantOptions: []string{"FileFormat", "IgnoreFirstRecord", "FlushImmediately", "ReportResultToTable"},
+		},
+		{
+			name:        "with streaming",
+			file:        "data.csv",
+			content:     "a,b\n1,2\n",
+			cfg:         func(c *Config) { c.IngestMode = StreamingIngest },
+			wantData:    "a,b\n",
+			wantOptions: []string{"FileFormat"},
+		},
+		{
+			name:        "compressed after dropping",
+			file:        "data.csv",
+			content:     "a,b\n1,2\n",
+			cfg:         func(c *Config) { c.Compress = true },
+			wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable", "CompressionType"},
+		},
+		{
+			name:    "json",
+			file:    "data.json",
+			content: `{"a":1}`,
+			wantErr: "ignore last record doesn't apply to json data",
+		},
+		{
+			name:    "compressed file",
+			file:    "data.csv.gz",
+			content: "not really gzipped",
+			wantErr: "compressed file",
+		},
+		{
+			name:    "single record",
+			file:    "data.csv",
+			content: "a,b\n",
+			wantErr: "single record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := testConfig()
+			cfg.IgnoreLastRecord = true
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+
+			ingestor := &fakeIngestor{}
+			err := IngestFile(context.Background(), ingestor, cfg, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("IngestFile() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if len(ingestor.paths) != 0 {
+					t.Errorf("IngestFile() ingested %v, want nothing", ingestor.paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IngestFile() error = %v", err)
+			}
+
+			if len(ingestor.paths) != 1 || ingestor.paths[0] == path {
+				t.Fatalf("IngestFile() ingested %v, want a copy of %q", ingestor.paths, path)
+			}
+			// Gzipped data isn't compared, only that it was compressed.
+			if !cfg.Compress && !reflect.DeepEqual(ingestor.data, []string{tt.wantData}) {
+				t.Errorf("IngestFile() ingested %q, want %q", ingestor.data, tt.wantData)
+			}
+			if !reflect.DeepEqual(ingestor.options, [][]string{tt.wantOptions}) {
+				t.Errorf("IngestFile() options = %v, want %v", ingestor.options, tt.wantOptions)
+			}
+			if _, err := os.Stat(ingestor.paths[0]); !os.IsNotExist(err) {
+				t.Errorf("IngestFile() left the copy %q behind", ingestor.paths[0])
+			}
+		})
+	}
+}
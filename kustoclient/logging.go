@@ -0,0 +1,11 @@
+package kustoclient
+
+import "log/slog"
+
+// logger is used for all of the package's output.
+var logger = slog.Default()
+
+// SetLogger replaces the logger used by the package. It defaults to slog.Default().
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
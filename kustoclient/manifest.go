@@ -0,0 +1,193 @@
+package kustoclient
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ManifestEntry is a file of a manifest and the table it is ingested into.
+type ManifestEntry struct {
+	Path  string `json:"path"`
+	Table string `json:"table"`
+}
+
+// ReadManifest reads the manifest at path, which lists files to ingest and the table each goes
+// into. A .json manifest is an array of {"path": ..., "table": ...} objects, and any other is a
+// CSV file of path,table records, optionally starting with a path,table header. Relative paths
+// are relative to the manifest's directory. Every file must exist and every table be named.
+func ReadManifest(path string) ([]ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+	defer f.Close()
+
+	var entries []ManifestEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		entries, err = parseJSONManifest(f)
+	} else {
+		entries, err = parseCSVManifest(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %q: %w", path, err)
+	}
+
+	if err := resolveManifest(entries, filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("invalid manifest %q: %w", path, err)
+	}
+
+	return entries, nil
+}
+
+// parseJSONManifest parses a JSON array of manifest entries.
+func parseJSONManifest(r io.Reader) ([]ManifestEntry, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var entries []ManifestEntry
+	if err := dec.Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// parseCSVManifest parses path,table records, skipping a path,table header.
+func parseCSVManifest(r io.Reader) ([]ManifestEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) > 0 && strings.EqualFold(records[0][0], "path") && strings.EqualFold(records[0][1], "table") {
+		records = records[1:]
+	}
+
+	entries := make([]ManifestEntry, len(records))
+	for i, record := range records {
+		entries[i] = ManifestEntry{Path: record[0], Table: record[1]}
+	}
+
+	return entries, nil
+}
+
+// resolveManifest makes the relative paths of entries relative to dir, and checks that each
+// entry names a table and an existing file, listed once.
+func resolveManifest(entries []ManifestEntry, dir string) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("no files listed")
+	}
+
+	seen := map[string]bool{}
+	for i := range entries {
+		entry := &entries[i]
+		entry.Path = strings.TrimSpace(entry.Path)
+		entry.Table = strings.TrimSpace(entry.Table)
+
+		if entry.Path == "" {
+			return fmt.Errorf("entry %d: path must not be empty", i+1)
+		}
+		if entry.Table == "" {
+			return fmt.Errorf("entry %d: table of %q must not be empty", i+1, entry.Path)
+		}
+
+		if !filepath.IsAbs(entry.Path) {
+			entry.Path = filepath.Join(dir, entry.Path)
+		}
+
+		info, err := os.Stat(entry.Path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("entry %d: file %q does not exist", i+1, entry.Path)
+			}
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("entry %d: %q is not a file", i+1, entry.Path)
+		}
+
+		if seen[entry.Path] {
+			return fmt.Errorf("entry %d: file %q is listed more than once", i+1, entry.Path)
+		}
+		seen[entry.Path] = true
+	}
+
+	return nil
+}
+
+// ManifestTables returns the distinct tables of entries, in the order they are first listed.
+func ManifestTables(entries []ManifestEntry) []string {
+	var tables []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if !seen[entry.Table] {
+			seen[entry.Table] = true
+			tables = append(tables, entry.Table)
+		}
+	}
+
+	return tables
+}
+
+// IngestManifest ingests each file of entries into its table, in the database ingested into,
+// overriding the ingestor's default table where they differ. The files are ingested as
+// IngestDirectory ingests a directory: up to cfg.Concurrency at a time, with one failing
+// file not stopping the others, and the failures returned together as a single error.
+func IngestManifest(ctx context.Context, ingestor Ingestor, cfg Config, entries []ManifestEntry) (err error) {
+	ctx, span := startSpan(ctx, "IngestManifest", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	if len(entries) == 0 {
+		return fmt.Errorf("no files to ingest in the manifest")
+	}
+
+	span.SetAttributes(attribute.Int("kusto.files", len(entries)), attribute.Int("kusto.tables", len(ManifestTables(entries))))
+
+	if cfg.DryRun {
+		for _, entry := range entries {
+			format, ingestOptions, err := manifestIngestOptions(cfg, entry)
+			if err != nil {
+				return err
+			}
+			logger.Info("Dry run, skipping ingestion", "table", entry.Table, "path", entry.Path, "format", format.String(), "options", optionNames(ingestOptions))
+		}
+		return nil
+	}
+
+	logger.Info("Ingesting manifest...", "files", len(entries), "tables", ManifestTables(entries))
+
+	return ingestDirectory(ctx, ingestor, cfg, entries)
+}
+
+// manifestIngestOptions returns the format of entry's file and the options to ingest it with,
+// which override the ingestor's default table when entry's table isn't the configured one.
+func manifestIngestOptions(cfg Config, entry ManifestEntry) (azkustoingest.DataFormat, []azkustoingest.FileOption, error) {
+	format, ingestOptions, err := fileIngestOptions(cfg, entry.Path)
+	if err != nil {
+		return format, nil, err
+	}
+
+	if entry.Table != cfg.Table {
+		ingestOptions = append(ingestOptions, azkustoingest.Table(entry.Table))
+	}
+
+	return format, ingestOptions, nil
+}
@@ -0,0 +1,149 @@
+package kustoclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"users.csv", "events.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users, events := filepath.Join(dir, "users.csv"), filepath.Join(dir, "events.json")
+
+	tests := []struct {
+		name     string
+		manifest string
+		content  string
+		want     []ManifestEntry
+		wantErr  string
+	}{
+		{
+			name:     "csv",
+			manifest: "manifest.csv",
+			content:  "users.csv,Users\nevents.json,Events\n",
+			want:     []ManifestEntry{{Path: users, Table: "Users"}, {Path: events, Table: "Events"}},
+		},
+		{
+			name:     "csv with header",
+			manifest: "manifest.csv",
+			content:  "path,table\nusers.csv, Users\n",
+			want:     []ManifestEntry{{Path: users, Table: "Users"}},
+		},
+		{
+			name:     "json",
+			manifest: "manifest.json",
+			content:  `[{"path":"users.csv","table":"Users"},{"path":"` + events + `","table":"Events"}]`,
+			want:     []ManifestEntry{{Path: users, Table: "Users"}, {Path: events, Table: "Events"}},
+		},
+		{
+			name:     "missing file",
+			manifest: "manifest.csv",
+			content:  "orders.csv,Orders\n",
+			wantErr:  "does not exist",
+		},
+		{
+			name:     "empty table",
+			manifest: "manifest.csv",
+			content:  "users.csv,\n",
+			wantErr:  "table of",
+		},
+		{
+			name:     "directory",
+			manifest: "manifest.csv",
+			content:  ".,Users\n",
+			wantErr:  "is not a file",
+		},
+		{
+			name:     "file listed twice",
+			manifest: "manifest.csv",
+			content:  "users.csv,Users\nusers.csv,Events\n",
+			wantErr:  "more than once",
+		},
+		{
+			name:     "wrong number of fields",
+			manifest: "manifest.csv",
+			content:  "users.csv\n",
+			wantErr:  "wrong number of fields",
+		},
+		{
+			name:     "unknown json field",
+			manifest: "manifest.json",
+			content:  `[{"file":"users.csv","table":"Users"}]`,
+			wantErr:  "unknown field",
+		},
+		{
+			name:     "empty",
+			manifest: "manifest.json",
+			content:  `[]`,
+			wantErr:  "no files listed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.manifest)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ReadManifest(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadManifest() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadManifest() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadManifest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngestManifest(t *testing.T) {
+	dir := t.TempDir()
+	var entries []ManifestEntry
+	for _, entry := range []ManifestEntry{{"default.csv", DefaultTable}, {"users.csv", "Users"}} {
+		path := filepath.Join(dir, entry.Path)
+		if err := os.WriteFile(path, []byte("a,b\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, ManifestEntry{Path: path, Table: entry.Table})
+	}
+
+	cfg := testConfig()
+	cfg.Concurrency = 1
+	ingestor := &fakeIngestor{}
+	if err := IngestManifest(context.Background(), ingestor, cfg, entries); err != nil {
+		t.Fatalf("IngestManifest() error = %v", err)
+	}
+
+	// Only the file going into another table than the ingestor's default overrides it.
+	want := [][]string{
+		{"FileFormat", "FlushImmediately", "ReportResultToTable"},
+		{"FileFormat", "FlushImmediately", "ReportResultToTable", "Table"},
+	}
+	if !reflect.DeepEqual(ingestor.options, want) {
+		t.Errorf("IngestManifest() ingested with options %v, want %v", ingestor.options, want)
+	}
+}
+
+func TestManifestTables(t *testing.T) {
+	entries := []ManifestEntry{{"a.csv", "Users"}, {"b.csv", "Events"}, {"c.csv", "Users"}}
+
+	if got, want := ManifestTables(entries), []string{"Users", "Events"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ManifestTables() = %v, want %v", got, want)
+	}
+}
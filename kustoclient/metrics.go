@@ -0,0 +1,85 @@
+package kustoclient
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ingestSuccessTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kusto_ingest_success_total",
+		Help: "Number of ingestions that completed successfully.",
+	})
+
+	ingestFailureTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kusto_ingest_failure_total",
+		Help: "Number of ingestions that failed, including failures to wait for their status.",
+	})
+
+	ingestDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kusto_ingest_duration_seconds",
+		Help:    "Time taken to ingest data and wait for its final status, including retries.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	})
+)
+
+// Counts kept for Stats, alongside the metrics.
+var (
+	ingestionsSucceeded atomic.Int64
+	ingestionsFailed    atomic.Int64
+	queryRowsWritten    atomic.Int64
+)
+
+// Stats counts what the package has done since the process started, for summing up a run.
+type Stats struct {
+	// Ingestions is the number of ingestions that completed successfully: one for each
+	// file, reader, blob or inline ingest command, whatever number of rows it held.
+	Ingestions int64
+
+	// FailedIngestions is the number of ingestions that failed.
+	FailedIngestions int64
+
+	// QueryRows is the number of rows Query has written out.
+	QueryRows int64
+}
+
+// ReadStats returns the package's counts so far.
+func ReadStats() Stats {
+	return Stats{
+		Ingestions:       ingestionsSucceeded.Load(),
+		FailedIngestions: ingestionsFailed.Load(),
+		QueryRows:        queryRowsWritten.Load(),
+	}
+}
+
+// RegisterMetrics registers the package's ingestion metrics with reg. The metrics are
+// always recorded, but only exposed once registered.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{ingestSuccessTotal, ingestFailureTotal, ingestDurationSeconds} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trackIngestion calls fn, which ingests data and waits for it to complete,
+// and records its outcome and duration in the ingestion metrics.
+func trackIngestion(fn func() error) error {
+	start := time.Now()
+	err := fn()
+	ingestDurationSeconds.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		ingestFailureTotal.Inc()
+		ingestionsFailed.Add(1)
+	} else {
+		ingestSuccessTotal.Inc()
+		ingestionsSucceeded.Add(1)
+	}
+
+	return err
+}
@@ -0,0 +1,321 @@
+package kustoclient
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+)
+
+// OutputFormat is how Query writes the rows it gets back.
+type OutputFormat int
+
+const (
+	LogOutput  OutputFormat = iota // Logs each row through the package logger
+	JSONOutput                     // Writes each row as a JSON object keyed by column name, one per line
+	CSVOutput                      // Writes the rows as CSV, with a header row of column names
+)
+
+// String returns the string representation of the OutputFormat.
+func (f OutputFormat) String() string {
+	switch f {
+	case LogOutput:
+		return "log"
+	case JSONOutput:
+		return "json"
+	case CSVOutput:
+		return "csv"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseOutputFormat maps an output format name (log, json or csv) to its OutputFormat.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	for _, f := range []OutputFormat{LogOutput, JSONOutput, CSVOutput} {
+		if strings.EqualFold(name, f.String()) {
+			return f, nil
+		}
+	}
+
+	return LogOutput, fmt.Errorf("unsupported output format %q, supported formats are: log, json, csv", name)
+}
+
+// rowWriter writes query result rows in a given output format.
+type rowWriter interface {
+	WriteHeader(columns []query.Column) error
+	WriteRow(row query.Row) error
+	Flush() error
+}
+
+// outputWriter returns cfg.Out, or os.Stdout when that is nil.
+func outputWriter(cfg Config) io.Writer {
+	if cfg.Out != nil {
+		return cfg.Out
+	}
+
+	return os.Stdout
+}
+
+// newRowWriter returns a rowWriter for cfg.Output. Formats other than LogOutput write to cfg.Out.
+func newRowWriter(cfg Config) (rowWriter, error) {
+	w := outputWriter(cfg)
+
+	switch cfg.Output {
+	case LogOutput:
+		return &logRowWriter{table: cfg.Table}, nil
+	case JSONOutput:
+		return jsonRowWriter{enc: json.NewEncoder(w)}, nil
+	case CSVOutput:
+		return csvRowWriter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("invalid output format: %d", cfg.Output)
+	}
+}
+
+// logRowWriter logs the rows through the package logger as column=value pairs, padded so
+// that the columns line up. Widths depend on every row, so rows are buffered until Flush,
+// and the columns of each flushed page are lined up separately.
+type logRowWriter struct {
+	table         string
+	columns       []query.Column
+	rows          []query.Row
+	loggedColumns bool
+}
+
+func (l *logRowWriter) WriteHeader(columns []query.Column) error {
+	l.columns = columns
+	return nil
+}
+
+func (l *logRowWriter) WriteRow(row query.Row) error {
+	l.rows = append(l.rows, row)
+	return nil
+}
+
+func (l *logRowWriter) Flush() error {
+	if len(l.columns) > 0 && !l.loggedColumns {
+		logger.Info("Columns", "table", l.table, "columns", columnTypes(l.columns))
+		l.loggedColumns = true
+	}
+
+	lines, err := alignedRows(l.columns, l.rows)
+	if err != nil {
+		return err
+	}
+	l.rows = l.rows[:0]
+
+	for _, line := range lines {
+		logger.Info("Row", "table", l.table, "row", line)
+	}
+
+	return nil
+}
+
+// columnTypes describes columns as name:type pairs, as in "Timestamp:datetime, Name:string".
+func columnTypes(columns []query.Column) string {
+	described := make([]string, len(columns))
+	for i, col := range columns {
+		described[i] = col.Name() + ":" + string(col.Type())
+	}
+
+	return strings.Join(described, ", ")
+}
+
+// alignedRows formats each row as space separated column=value pairs, with every pair
+// padded to the widest in its column. The last column isn't padded.
+func alignedRows(columns []query.Column, rows []query.Row) ([]string, error) {
+	pairs := make([][]string, len(rows))
+	widths := make([]int, len(columns))
+	for r, row := range rows {
+		pairs[r] = make([]string, len(columns))
+		for i, col := range columns {
+			v, err := row.Value(i)
+			if err != nil {
+				return nil, fmt.Errorf("error reading column %s: %w", col.Name(), err)
+			}
+			pairs[r][i] = col.Name() + "=" + logValue(v)
+			widths[i] = max(widths[i], len(pairs[r][i]))
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for r := range rows {
+		var b strings.Builder
+		for i, pair := range pairs[r] {
+			if i == len(pairs[r])-1 {
+				b.WriteString(pair)
+				break
+			}
+			fmt.Fprintf(&b, "%-*s  ", widths[i], pair)
+		}
+		lines[r] = b.String()
+	}
+
+	return lines, nil
+}
+
+// logValue formats a Kusto value for logging. Strings are quoted so that empty strings and
+// surrounding spaces stay visible, and nulls of any type are shown as null.
+func logValue(v value.Kusto) string {
+	switch v := v.(type) {
+	case *value.String:
+		return strconv.Quote(v.Value)
+	case *value.Dynamic:
+		if v.Value == nil {
+			return "null"
+		}
+		return string(v.Value)
+	}
+
+	if rv := reflect.ValueOf(v.GetValue()); !rv.IsValid() || (rv.Kind() == reflect.Pointer && rv.IsNil()) {
+		return "null"
+	}
+
+	return csvValue(v)
+}
+
+// jsonRowWriter writes each row as a line-delimited JSON object.
+type jsonRowWriter struct {
+	enc *json.Encoder
+}
+
+func (j jsonRowWriter) WriteHeader(columns []query.Column) error {
+	return nil
+}
+
+func (j jsonRowWriter) WriteRow(row query.Row) error {
+	obj := make(map[string]any, len(row.Columns()))
+	for i, col := range row.Columns() {
+		v, err := row.Value(i)
+		if err != nil {
+			return fmt.Errorf("error reading column %s: %w", col.Name(), err)
+		}
+		obj[col.Name()] = jsonValue(v)
+	}
+
+	if err := j.enc.Encode(obj); err != nil {
+		return fmt.Errorf("error writing row: %w", err)
+	}
+
+	return nil
+}
+
+func (j jsonRowWriter) Flush() error {
+	return nil
+}
+
+// jsonValue converts a Kusto value into something that marshals to the matching JSON value.
+// Nulls become JSON nulls and dynamic values are embedded as JSON rather than as strings.
+func jsonValue(v value.Kusto) any {
+	switch v := v.(type) {
+	case *value.Dynamic:
+		if v.Value == nil {
+			return nil
+		}
+		return json.RawMessage(v.Value)
+	case *value.Timespan:
+		// A time.Duration would marshal as nanoseconds, use the Kusto representation instead.
+		if v.Ptr() == nil {
+			return nil
+		}
+		return timespanString(*v.Ptr())
+	default:
+		return v.GetValue()
+	}
+}
+
+// csvRowWriter writes the rows as CSV records.
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func (c csvRowWriter) WriteHeader(columns []query.Column) error {
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.Name()
+	}
+
+	if err := c.w.Write(header); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+
+	return nil
+}
+
+func (c csvRowWriter) WriteRow(row query.Row) error {
+	record := make([]string, len(row.Columns()))
+	for i, col := range row.Columns() {
+		v, err := row.Value(i)
+		if err != nil {
+			return fmt.Errorf("error reading column %s: %w", col.Name(), err)
+		}
+		record[i] = csvValue(v)
+	}
+
+	if err := c.w.Write(record); err != nil {
+		return fmt.Errorf("error writing row: %w", err)
+	}
+
+	return nil
+}
+
+func (c csvRowWriter) Flush() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return fmt.Errorf("error writing csv: %w", err)
+	}
+
+	return nil
+}
+
+// csvValue formats a Kusto value as a CSV field. Nulls become empty fields.
+func csvValue(v value.Kusto) string {
+	switch v := v.(type) {
+	case *value.DateTime:
+		if v.Ptr() == nil {
+			return ""
+		}
+		return v.Ptr().Format(time.RFC3339Nano)
+	case *value.Timespan:
+		if v.Ptr() == nil {
+			return ""
+		}
+		return timespanString(*v.Ptr())
+	default:
+		return v.String()
+	}
+}
+
+// timespanString formats d as a Kusto timespan, [-][d.]hh:mm:ss[.fffffff]. Timespan.Marshal
+// isn't used as it trims trailing zeros from the seconds as well as the fraction, so that
+// 90 seconds comes out as 00:01:3.
+func timespanString(d time.Duration) string {
+	var b strings.Builder
+	if d < 0 {
+		b.WriteString("-")
+		d = -d
+	}
+
+	if days := d / (24 * time.Hour); days > 0 {
+		fmt.Fprintf(&b, "%d.", days)
+		d -= days * 24 * time.Hour
+	}
+
+	fmt.Fprintf(&b, "%02d:%02d:%02d", d/time.Hour, d%time.Hour/time.Minute, d%time.Minute/time.Second)
+
+	// Kusto timespans have a precision of 100ns ticks.
+	if ticks := d % time.Second / 100; ticks > 0 {
+		b.WriteString(strings.TrimRight(fmt.Sprintf(".%07d", ticks), "0"))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package kustoclient
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+)
+
+func TestAlignedRows(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC)
+	dataset := testDataset(
+		[]value.Kusto{value.NewDateTime(ts), value.NewString("first")},
+		[]value.Kusto{value.NewNullDateTime(), value.NewString("")},
+	)
+	table := dataset.Tables()[0]
+
+	got, err := alignedRows(table.Columns(), table.Rows())
+	if err != nil {
+		t.Fatalf("alignedRows() error = %v", err)
+	}
+
+	want := []string{
+		`Timestamp=2024-06-01T12:30:45Z  Name="first"`,
+		`Timestamp=null                  Name=""`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("alignedRows() = %q, want %q", got, want)
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	tests := []struct {
+		name string
+		v    value.Kusto
+		want string
+	}{
+		{name: "long", v: value.NewLong(42), want: "42"},
+		{name: "null long", v: value.NewNullLong(), want: "null"},
+		{name: "string", v: value.NewString("a b"), want: `"a b"`},
+		{name: "dynamic", v: value.NewDynamic([]byte(`{"a":1}`)), want: `{"a":1}`},
+		{name: "null dynamic", v: value.NewNullDynamic(), want: "null"},
+		{name: "timespan", v: value.NewTimespan(90 * time.Second), want: "00:01:30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logValue(tt.v); got != tt.want {
+				t.Errorf("logValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimespanString(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "00:00:00"},
+		{d: 90 * time.Second, want: "00:01:30"},
+		{d: 26*time.Hour + 500*time.Millisecond, want: "1.02:00:00.5"},
+		{d: -(10*time.Minute + 1234567*time.Microsecond/10), want: "-00:10:00.1234567"},
+		{d: 150 * time.Nanosecond, want: "00:00:00.0000001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := timespanString(tt.d); got != tt.want {
+				t.Errorf("timespanString(%v) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pendingIngestion is an ingestion whose status was still pending when the wait for it was
+// interrupted. A goroutine keeps reading its status until WaitPending abandons it.
+type pendingIngestion struct {
+	source string
+	since  time.Time
+	cancel context.CancelFunc
+
+	// done is closed once the final status is known, and err set to its outcome.
+	done chan struct{}
+	err  error
+}
+
+var (
+	pendingMu sync.Mutex
+	pending   []*pendingIngestion
+)
+
+// addPending hands the ingestion of source over to WaitPending, which reads its final
+// status from done. cancel stops the SDK reading the status table for it.
+func addPending(cfg Config, source string, done <-chan error, cancel context.CancelFunc) {
+	p := &pendingIngestion{source: source, since: time.Now(), cancel: cancel, done: make(chan struct{})}
+	go func() {
+		p.err = ingestionOutcome(cfg, source, <-done)
+		close(p.done)
+	}()
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	pending = append(pending, p)
+}
+
+// WaitPending waits for the ingestions that were still pending when waiting for them was
+// interrupted, as by a shutdown signal, until they complete or ctx is done. Ingestions still
+// pending then are logged and abandoned. It returns an error if any of them failed or were
+// left pending, so that an interrupted run doesn't look successful. Call it before closing
+// the ingestor, once the work submitting ingestions has returned.
+func WaitPending(ctx context.Context) error {
+	pendingMu.Lock()
+	waiting := pending
+	pending = nil
+	pendingMu.Unlock()
+
+	if len(waiting) == 0 {
+		return nil
+	}
+
+	logger.Info("Waiting for pending ingestions to complete", "count", len(waiting))
+
+	var errs []error
+	var abandoned int
+	for _, p := range waiting {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+		}
+
+		select {
+		case <-p.done:
+			if p.err != nil {
+				errs = append(errs, p.err)
+			}
+		default:
+			p.cancel()
+			abandoned++
+			logger.Warn("Ingestion still pending", "source", p.source, "pendingFor", time.Since(p.since).Round(time.Second).String())
+		}
+	}
+
+	if abandoned > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d ingestions were still pending at shutdown, check their status with .show ingestion failures or by querying the table", abandoned, len(waiting)))
+	}
+
+	return categorize(ErrIngest, errors.Join(errs...))
+}
@@ -0,0 +1,44 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitPending(t *testing.T) {
+	succeeded := make(chan error)
+	close(succeeded)
+
+	failed := make(chan error, 1)
+	failed <- errors.New("upload rejected")
+
+	stuck := make(chan error)
+	var stuckCancelled bool
+
+	addPending(testConfig(), "a.csv", succeeded, func() {})
+	addPending(testConfig(), "b.csv", failed, func() {})
+	addPending(testConfig(), "c.csv", stuck, func() { stuckCancelled = true })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := WaitPending(ctx)
+	if err == nil {
+		t.Fatal("WaitPending() error = nil, want the failure and the pending ingestion")
+	}
+	for _, want := range []string{"upload rejected", "1 of 3 ingestions were still pending"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("WaitPending() error = %v, want one containing %q", err, want)
+		}
+	}
+	if !stuckCancelled {
+		t.Error("WaitPending() didn't cancel the wait for the pending ingestion")
+	}
+
+	if err := WaitPending(context.Background()); err != nil {
+		t.Errorf("second WaitPending() error = %v, want nil once abandoned", err)
+	}
+}
@@ -0,0 +1,106 @@
+package kustoclient
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+)
+
+// CheckTable checks that the configured table exists in the database ingested into, so that a
+// mistyped name fails straight away rather than once the queued ingestion is processed.
+func CheckTable(ctx context.Context, client Querier, cfg Config) (err error) {
+	ctx, span := startSpan(ctx, "CheckTable", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	command := showTableSchemaCommand(cfg.Table)
+	if _, err := client.Mgmt(ctx, cfg.IngestDB(), kql.New("").AddUnsafe(command)); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("table %q doesn't exist in database %q, check -table and -database, or -ingest-database", cfg.Table, cfg.IngestDB())
+		}
+		return fmt.Errorf("error checking table %q exists: %w", cfg.Table, err)
+	}
+
+	return nil
+}
+
+// CheckColumns checks that the columns Query reads from the configured table exist: the
+// Timestamp column it orders and filters rows by, and cfg.Columns if set. It reads the table's
+// schema with a management command, so that a mistyped column fails straight away, with the
+// table's columns listed, rather than costing a query.
+func CheckColumns(ctx context.Context, client Querier, cfg Config) (err error) {
+	ctx, span := startSpan(ctx, "CheckColumns", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	command := fmt.Sprintf(".show table %s cslschema", quoteTable(cfg.Table))
+	dataset, err := client.Mgmt(ctx, cfg.QueryDB(), kql.New("").AddUnsafe(command))
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("table %q doesn't exist in database %q, check -table and -database, or -query-database", cfg.Table, cfg.QueryDB())
+		}
+		return fmt.Errorf("error getting schema of table %q: %w", cfg.Table, err)
+	}
+
+	tables := dataset.Tables()
+	if len(tables) == 0 || len(tables[0].Rows()) == 0 {
+		return fmt.Errorf("error getting schema of table %q: command returned no rows", cfg.Table)
+	}
+
+	schema, err := tables[0].Rows()[0].StringByName("Schema")
+	if err != nil {
+		return fmt.Errorf("error reading schema of table %q: %w", cfg.Table, err)
+	}
+	existing := cslSchemaColumns(schema)
+
+	var missing []string
+	for _, column := range append([]string{"Timestamp"}, cfg.Columns...) {
+		if !slices.Contains(existing, column) && !slices.Contains(missing, column) {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("column %s not found in table %q, which has columns %s; check -columns, or skip this check with -no-preflight", strings.Join(missing, ", "), cfg.Table, strings.Join(existing, ", "))
+	}
+
+	return nil
+}
+
+// cslSchemaColumns returns the column names of a name:type,name:type schema, as shown by
+// .show table cslschema. Names the service brackets, such as ['a b'], are left bracketed, as
+// they can't be any of the plain names Query reads.
+func cslSchemaColumns(schema string) []string {
+	var columns []string
+	for _, column := range strings.Split(schema, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(column), ":")
+		if name != "" {
+			columns = append(columns, name)
+		}
+	}
+
+	return columns
+}
+
+// showTableSchemaCommand returns the command showing the schema of table. Management commands
+// can't take query parameters, so the name is quoted with quoteTable instead.
+func showTableSchemaCommand(table string) string {
+	return fmt.Sprintf(".show table %s schema", quoteTable(table))
+}
+
+// quoteTable quotes a table name as a bracketed string literal, for use in management commands.
+func quoteTable(table string) string {
+	return "['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(table) + "']"
+}
+
+// isNotFound reports whether err is the service reporting that an entity, such as a table, doesn't exist.
+func isNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "EntityNotFound") || strings.Contains(msg, "could not be found") || strings.Contains(msg, "was not found")
+}
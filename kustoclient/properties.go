@@ -0,0 +1,105 @@
+package kustoclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+// ingestionProperties map the names, in lower case, of the Kusto ingestion properties that can
+// be set in Config.Properties to the function returning the option setting one to a value, or
+// nil when the value is the property's default. The SDK has no way to set other properties,
+// such as zipPattern.
+var ingestionProperties = map[string]func(value string) (azkustoingest.FileOption, error){
+	"ignorefirstrecord": func(value string) (azkustoingest.FileOption, error) {
+		ignore, err := strconv.ParseBool(value)
+		if err != nil || !ignore {
+			return nil, err
+		}
+		return azkustoingest.IgnoreFirstRecord(), nil
+	},
+	"validationpolicy": func(value string) (azkustoingest.FileOption, error) {
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.DisallowUnknownFields()
+
+		var policy azkustoingest.ValPolicy
+		if err := dec.Decode(&policy); err != nil {
+			return nil, fmt.Errorf(`must be a JSON object such as {"ValidationOptions":1,"ValidationImplications":0}: %w`, err)
+		}
+		return azkustoingest.ValidationPolicy(policy), nil
+	},
+	"creationtime": func(value string) (azkustoingest.FileOption, error) {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("must be an RFC3339 time such as 2024-06-01T00:00:00Z")
+		}
+		return azkustoingest.SetCreationTime(t), nil
+	},
+}
+
+// ParseProperty splits a key=value ingestion property into its key and value.
+func ParseProperty(prop string) (string, string, error) {
+	key, value, ok := strings.Cut(prop, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid ingestion property %q: must be key=value", prop)
+	}
+
+	return key, value, nil
+}
+
+// UnknownProperties returns the keys of props that aren't ingestion properties that can be
+// set, sorted. They are ignored when ingesting.
+func UnknownProperties(props map[string]string) []string {
+	var unknown []string
+	for key := range props {
+		if _, ok := ingestionProperties[strings.ToLower(key)]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// propertyOptions returns the options setting the ingestion properties in cfg.Properties that
+// can be set, in the order of their keys, skipping the others. None is supported by streaming
+// ingestion.
+func propertyOptions(cfg Config) ([]azkustoingest.FileOption, error) {
+	keys := make([]string, 0, len(cfg.Properties))
+	for key := range cfg.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var opts []azkustoingest.FileOption
+	for _, key := range keys {
+		property, ok := ingestionProperties[strings.ToLower(key)]
+		if !ok {
+			continue
+		}
+
+		opt, err := property(cfg.Properties[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ingestion property %s=%q: %w", key, cfg.Properties[key], err)
+		}
+		// The creation time would be set twice, and the SDK applies whichever comes last.
+		if strings.EqualFold(key, "creationTime") && !cfg.CreationTime.IsZero() {
+			return nil, fmt.Errorf("the creationTime ingestion property and a creation time can't be used together")
+		}
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+	}
+
+	if len(opts) > 0 && cfg.IngestMode == StreamingIngest {
+		return nil, fmt.Errorf("ingestion properties can't be used with streaming ingestion, use queued or managed ingestion instead")
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,121 @@
+package kustoclient
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProperty(t *testing.T) {
+	tests := []struct {
+		prop      string
+		wantKey   string
+		wantValue string
+		wantErr   bool
+	}{
+		{prop: "ignoreFirstRecord=true", wantKey: "ignoreFirstRecord", wantValue: "true"},
+		{prop: `validationPolicy={"ValidationOptions":1}`, wantKey: "validationPolicy", wantValue: `{"ValidationOptions":1}`},
+		{prop: "zipPattern=*.csv=x", wantKey: "zipPattern", wantValue: "*.csv=x"},
+		{prop: "key=", wantKey: "key"},
+		{prop: "ignoreFirstRecord", wantErr: true},
+		{prop: "=true", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prop, func(t *testing.T) {
+			key, value, err := ParseProperty(tt.prop)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProperty() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if key != tt.wantKey || value != tt.wantValue {
+				t.Errorf("ParseProperty() = %q, %q, want %q, %q", key, value, tt.wantKey, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestUnknownProperties(t *testing.T) {
+	props := map[string]string{"IgnoreFirstRecord": "true", "zipPattern": "*.csv", "format": "csv"}
+
+	if got, want := UnknownProperties(props), []string{"format", "zipPattern"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnknownProperties() = %v, want %v", got, want)
+	}
+}
+
+func TestPropertyOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(*Config)
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "recognized properties",
+			cfg: func(c *Config) {
+				c.Properties = map[string]string{
+					"ignoreFirstRecord": "true",
+					"validationPolicy":  `{"ValidationOptions":1,"ValidationImplications":0}`,
+					"creationTime":      "2024-06-01T00:00:00Z",
+				}
+			},
+			want: []string{"SetCreationTime", "IgnoreFirstRecord", "ValidationPolicy"},
+		},
+		{
+			name: "default value",
+			cfg:  func(c *Config) { c.Properties = map[string]string{"ignoreFirstRecord": "false"} },
+		},
+		{
+			name: "unknown properties are skipped",
+			cfg:  func(c *Config) { c.Properties = map[string]string{"zipPattern": "*.csv"} },
+		},
+		{
+			name:    "invalid value",
+			cfg:     func(c *Config) { c.Properties = map[string]string{"ignoreFirstRecord": "maybe"} },
+			wantErr: "invalid ingestion property ignoreFirstRecord",
+		},
+		{
+			name:    "invalid validation policy",
+			cfg:     func(c *Config) { c.Properties = map[string]string{"validationPolicy": `{"Options":1}`} },
+			wantErr: "must be a JSON object",
+		},
+		{
+			name: "creation time set twice",
+			cfg: func(c *Config) {
+				c.Properties = map[string]string{"creationTime": "2024-06-01T00:00:00Z"}
+				c.CreationTime = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+			},
+			wantErr: "can't be used together",
+		},
+		{
+			name: "streaming",
+			cfg: func(c *Config) {
+				c.Properties = map[string]string{"ignoreFirstRecord": "true"}
+				c.IngestMode = StreamingIngest
+			},
+			wantErr: "streaming",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.cfg(&cfg)
+
+			opts, err := propertyOptions(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("propertyOptions() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("propertyOptions() error = %v", err)
+			}
+
+			if got := optionNames(opts); !reflect.DeepEqual(got, tt.want) && (len(got) != 0 || len(tt.want) != 0) {
+				t.Errorf("propertyOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
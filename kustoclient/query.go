@@ -0,0 +1,389 @@
+package kustoclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	v1 "github.com/Azure/azure-kusto-go/azkustodata/query/v1"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// NewQueryClient gets a Kusto client using the given connection string builder,
+// sending its requests through cfg.ProxyURL and trusting cfg.CACertFile if they are set.
+func NewQueryClient(kcsb *azkustodata.ConnectionStringBuilder, cfg Config) (*azkustodata.Client, error) {
+	httpClient, err := httpClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var options []azkustodata.Option
+	if httpClient != nil {
+		options = append(options, azkustodata.WithHttpClient(httpClient))
+	}
+
+	client, err := azkustodata.New(kcsb, options...)
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating kusto client: %w", err)
+	}
+
+	return client, nil
+}
+
+// Querier runs queries and management commands against a Kusto database.
+// *azkustodata.Client implements it.
+type Querier interface {
+	Query(ctx context.Context, db string, kqlQuery azkustodata.Statement, options ...azkustodata.QueryOption) (query.Dataset, error)
+	IterativeQuery(ctx context.Context, db string, kqlQuery azkustodata.Statement, options ...azkustodata.QueryOption) (query.IterativeDataset, error)
+	Mgmt(ctx context.Context, db string, kqlQuery azkustodata.Statement, options ...azkustodata.QueryOption) (v1.Dataset, error)
+}
+
+// Query gets the last cfg.Limit rows (DefaultLimit if unset) from the configured table
+// and writes them in cfg.Output format. Iterative queries write the rows a page of
+// cfg.PageSize at a time, stopping between pages if ctx is cancelled.
+func Query(ctx context.Context, client Querier, cfg Config) (err error) {
+	ctx, span := startSpan(ctx, "Query", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	limit := cfg.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	rows, err := newRowWriter(cfg)
+	if err != nil {
+		return err
+	}
+
+	stmt, params := lastRowsQuery(cfg.Table, limit, queryTimeRange(cfg, time.Now()), cfg.Columns)
+
+	requestID := clientRequestID(cfg)
+	span.SetAttributes(attribute.String("kusto.client_request_id", requestID))
+	logger.Info("Querying table...", "table", cfg.Table, "requestID", requestID)
+	options := append(requestOptions(cfg, requestID), azkustodata.QueryParameters(params))
+
+	if cfg.Raw {
+		count, err := queryRaw(ctx, client, cfg, stmt, options...)
+		span.SetAttributes(attribute.Int("kusto.rows", count))
+		queryRowsWritten.Add(int64(count))
+		return err
+	}
+
+	if cfg.NonIterative {
+		results, err := queryAll(ctx, client, cfg.QueryDB(), stmt, options...)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Results:", "table", cfg.Table)
+		span.SetAttributes(attribute.Int("kusto.rows", len(results)))
+		var columns []query.Column
+		if len(results) > 0 {
+			columns = results[0].Columns()
+		}
+
+		if err := writeRows(rows, columns, results); err != nil {
+			return err
+		}
+		queryRowsWritten.Add(int64(len(results)))
+
+		return nil
+	}
+
+	dataset, err := client.IterativeQuery(ctx, cfg.QueryDB(), stmt, options...)
+	if err != nil {
+		return fmt.Errorf("error querying dataset: %w", err)
+	}
+
+	// Every table must be read to the end, however Query returns, for the SDK's goroutines
+	// decoding the response to finish. Close runs after the tables are drained.
+	defer func() {
+		if drainErr := drainTables(dataset); err == nil {
+			err = drainErr
+		}
+		if closeErr := dataset.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing dataset: %w", closeErr)
+		}
+	}()
+
+	primaryResult, ok := <-dataset.Tables() // The first table in the dataset will be the primary results.
+	if !ok {
+		return fmt.Errorf("error getting primary result: query returned no tables")
+	}
+
+	// Make sure to check for errors.
+	if primaryResult.Err() != nil {
+		return fmt.Errorf("error getting primary result: %w", primaryResult.Err())
+	}
+
+	// Skips the rest of the primary result if Query returns part way through it.
+	defer primaryResult.Table().SkipToEnd()
+
+	logger.Info("Results:", "table", cfg.Table)
+	if err := rows.WriteHeader(primaryResult.Table().Columns()); err != nil {
+		return err
+	}
+
+	pageSize := cfg.PageSize
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+
+	count := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("kusto.rows", count))
+		queryRowsWritten.Add(int64(count))
+	}()
+	for rowResult := range primaryResult.Table().Rows() {
+		if rowResult.Err() != nil {
+			return fmt.Errorf("error getting row result: %w", rowResult.Err())
+		}
+
+		if err := rows.WriteRow(rowResult.Row()); err != nil {
+			return err
+		}
+		count++
+
+		if count%pageSize == 0 {
+			if err := rows.Flush(); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("query cancelled after %d rows: %w", count, err)
+			}
+		}
+	}
+
+	return rows.Flush()
+}
+
+// clientRequestID returns cfg.RequestID, or when that is empty a new ID in the
+// <application>;<GUID> form Kusto's own clients use.
+func clientRequestID(cfg Config) string {
+	if cfg.RequestID != "" {
+		return cfg.RequestID
+	}
+
+	return "go-kusto-test;" + uuid.NewString()
+}
+
+// requestOptions returns the client request properties a query is sent with: its client
+// request ID and, if set, cfg.ServerTimeout.
+func requestOptions(cfg Config, requestID string) []azkustodata.QueryOption {
+	options := []azkustodata.QueryOption{azkustodata.ClientRequestID(requestID)}
+
+	if cfg.ServerTimeout > 0 {
+		// azkustodata.ServerTimeout formats the timeout with Timespan.Marshal, which mangles
+		// some durations, see timespanString.
+		options = append(options, azkustodata.CustomQueryOption(azkustodata.ServerTimeoutValue, timespanString(cfg.ServerTimeout)))
+	}
+
+	return options
+}
+
+// drainTables reads the tables following the primary result of an iterative query, its
+// query properties and completion information, discarding their rows so that the SDK's
+// goroutines decoding the response can finish. It returns any errors reported after the
+// primary result.
+func drainTables(dataset query.IterativeDataset) error {
+	var errs []error
+	for tableResult := range dataset.Tables() {
+		if err := tableResult.Err(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		table := tableResult.Table()
+		logger.Debug("Discarding secondary table", "name", table.Name(), "kind", table.Kind())
+		errs = append(errs, table.SkipToEnd()...)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error reading query results: %w", err)
+	}
+
+	return nil
+}
+
+// Count counts the rows in the configured table and writes the count in cfg.Output format:
+// logged for LogOutput, as a {"table", "count"} object for JSONOutput, and as a single
+// count column for CSVOutput. Only the count is sent back, however large the table.
+func Count(ctx context.Context, client Querier, cfg Config) (err error) {
+	ctx, span := startSpan(ctx, "Count", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	query := kql.New("table(tableName) | count")
+	params := kql.NewParameters().AddString("tableName", cfg.Table)
+
+	count, err := countRows(ctx, client, cfg.QueryDB(), query, params)
+	if err != nil {
+		return fmt.Errorf("error counting rows: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("kusto.count", count))
+
+	w := outputWriter(cfg)
+	switch cfg.Output {
+	case LogOutput:
+		logger.Info("Count", "table", cfg.Table, "count", count)
+	case JSONOutput:
+		err = json.NewEncoder(w).Encode(struct {
+			Table string `json:"table"`
+			Count int64  `json:"count"`
+		}{cfg.Table, count})
+	case CSVOutput:
+		_, err = fmt.Fprintf(w, "count\n%d\n", count)
+	default:
+		return fmt.Errorf("invalid output format: %d", cfg.Output)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing count: %w", err)
+	}
+
+	return nil
+}
+
+// Command runs the management command against the configured database and writes
+// its primary result in cfg.Output format.
+func Command(ctx context.Context, client Querier, cfg Config, command string) (err error) {
+	ctx, span := startSpan(ctx, "Command", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	if !strings.HasPrefix(strings.TrimSpace(command), ".") {
+		return fmt.Errorf("invalid management command %q: must start with a dot", command)
+	}
+
+	rows, err := newRowWriter(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Management commands can't take query parameters, the command is user input run as-is.
+	dataset, err := client.Mgmt(ctx, cfg.QueryDB(), kql.New("").AddUnsafe(command))
+	if err != nil {
+		return fmt.Errorf("error running management command: %w", err)
+	}
+
+	tables := dataset.Tables()
+	if len(tables) == 0 {
+		return fmt.Errorf("error getting primary result: command returned no tables")
+	}
+
+	logger.Info("Results:", "command", command)
+	span.SetAttributes(attribute.Int("kusto.rows", len(tables[0].Rows())))
+	return writeRows(rows, tables[0].Columns(), tables[0].Rows())
+}
+
+// writeRows writes a header for columns, if there are any, followed by rows, and flushes w.
+func writeRows(w rowWriter, columns []query.Column, rows []query.Row) error {
+	if len(columns) > 0 {
+		if err := w.WriteHeader(columns); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// queryAll runs stmt with the non-iterative query API and returns every row of its primary result.
+// The whole result is held in memory, so it is only suitable for small result sets.
+func queryAll(ctx context.Context, client Querier, database string, stmt azkustodata.Statement, options ...azkustodata.QueryOption) ([]query.Row, error) {
+	dataset, err := client.Query(ctx, database, stmt, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dataset: %w", err)
+	}
+
+	tables := dataset.Tables()
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("error getting primary result: query returned no tables")
+	}
+
+	return tables[0].Rows(), nil
+}
+
+// timeRange is the window of Timestamps Query returns rows from. A zero From or To leaves
+// that end of the window open.
+type timeRange struct {
+	From, To time.Time
+}
+
+// queryTimeRange returns the window set by cfg.Since, counting back from now, or by cfg.From
+// and cfg.To.
+func queryTimeRange(cfg Config, now time.Time) timeRange {
+	if cfg.Since > 0 {
+		return timeRange{From: now.Add(-cfg.Since), To: now}
+	}
+
+	return timeRange{From: cfg.From, To: cfg.To}
+}
+
+// lastRowsQuery builds a query for the newest limit rows of table within window, projected
+// to columns when there are any. The table, limit and window are passed as declared query
+// parameters rather than interpolated, so none of them can inject into the query. Columns
+// can't be parameters, they are checked by Config.Validate and added as identifiers instead.
+func lastRowsQuery(table string, limit int, window timeRange, columns []string) (*kql.Builder, *kql.Parameters) {
+	query := kql.New("table(tableName)")
+	params := kql.NewParameters().
+		AddString("tableName", table).
+		AddLong("rowLimit", int64(limit))
+
+	switch {
+	case !window.From.IsZero() && !window.To.IsZero():
+		query.AddLiteral(" | where Timestamp between (fromTime .. toTime)")
+		params.AddDateTime("fromTime", window.From).AddDateTime("toTime", window.To)
+	case !window.From.IsZero():
+		query.AddLiteral(" | where Timestamp >= fromTime")
+		params.AddDateTime("fromTime", window.From)
+	case !window.To.IsZero():
+		query.AddLiteral(" | where Timestamp <= toTime")
+		params.AddDateTime("toTime", window.To)
+	}
+
+	query.AddLiteral(" | order by Timestamp desc | take rowLimit")
+	for i, column := range columns {
+		if i == 0 {
+			query.AddLiteral(" | project ")
+		} else {
+			query.AddLiteral(", ")
+		}
+		query.AddColumn(column)
+	}
+
+	return query, params
+}
+
+// columnNamePattern matches the column names Query can be limited to: letters, digits and
+// underscores, not starting with a digit.
+var columnNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateColumn checks that column is a plain column name.
+func validateColumn(column string) error {
+	if !columnNamePattern.MatchString(column) {
+		return fmt.Errorf("invalid column %q: must be letters, digits and underscores, not starting with a digit", column)
+	}
+
+	return nil
+}
@@ -0,0 +1,676 @@
+package kustoclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	v1 "github.com/Azure/azure-kusto-go/azkustodata/query/v1"
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+)
+
+// fakeQuerier answers non-iterative queries with a fixed dataset and records what it was asked.
+type fakeQuerier struct {
+	dataset query.Dataset
+
+	db    string
+	query string
+
+	// mgmt, if set, is returned by Mgmt, and mgmtErr, if set, instead of the default error.
+	mgmt    v1.Dataset
+	mgmtErr error
+
+	// iterative, if set, is returned by IterativeQuery.
+	iterative *fakeIterativeDataset
+}
+
+func (f *fakeQuerier) Query(ctx context.Context, db string, kqlQuery azkustodata.Statement, options ...azkustodata.QueryOption) (query.Dataset, error) {
+	f.db = db
+	f.query = kqlQuery.String()
+	return f.dataset, nil
+}
+
+func (f *fakeQuerier) IterativeQuery(ctx context.Context, db string, kqlQuery azkustodata.Statement, options ...azkustodata.QueryOption) (query.IterativeDataset, error) {
+	f.db = db
+	f.query = kqlQuery.String()
+	if f.iterative == nil {
+		return nil, errors.New("iterative queries aren't supported by the fake")
+	}
+	return f.iterative, nil
+}
+
+// fakeIterativeDataset streams the tables of a dataset followed by secondary tables and,
+// if set, an error, the way the iterative query API streams a response.
+type fakeIterativeDataset struct {
+	query.BaseDataset
+	tables chan query.TableResult
+
+	// skipped counts the secondary tables read to the end with SkipToEnd.
+	skipped int
+	closed  bool
+}
+
+func newFakeIterativeDataset(dataset query.Dataset, secondary []query.Table, err error) *fakeIterativeDataset {
+	d := &fakeIterativeDataset{BaseDataset: dataset, tables: make(chan query.TableResult, len(dataset.Tables())+len(secondary)+1)}
+	for _, table := range append(dataset.Tables(), secondary...) {
+		d.tables <- query.TableResultSuccess(fakeIterativeTable{Table: table, dataset: d})
+	}
+	if err != nil {
+		d.tables <- query.TableResultError(err)
+	}
+	close(d.tables)
+
+	return d
+}
+
+func (d *fakeIterativeDataset) Tables() <-chan query.TableResult { return d.tables }
+
+func (d *fakeIterativeDataset) ToDataset() (query.Dataset, error) {
+	return nil, errors.New("ToDataset isn't supported by the fake")
+}
+
+func (d *fakeIterativeDataset) Close() error {
+	d.closed = true
+	return nil
+}
+
+// fakeIterativeTable streams the rows of a table.
+type fakeIterativeTable struct {
+	query.Table
+	dataset *fakeIterativeDataset
+}
+
+func (t fakeIterativeTable) Rows() <-chan query.RowResult {
+	rows := make(chan query.RowResult, len(t.Table.Rows()))
+	for _, row := range t.Table.Rows() {
+		rows <- query.RowResultSuccess(row)
+	}
+	close(rows)
+
+	return rows
+}
+
+func (t fakeIterativeTable) SkipToEnd() []error {
+	if !t.IsPrimaryResult() {
+		t.dataset.skipped++
+	}
+	return nil
+}
+
+func (t fakeIterativeTable) ToTable() (query.Table, error) { return t.Table, nil }
+
+func (f *fakeQuerier) Mgmt(ctx context.Context, db string, kqlQuery azkustodata.Statement, options ...azkustodata.QueryOption) (v1.Dataset, error) {
+	f.db = db
+	f.query = kqlQuery.String()
+	if f.mgmtErr != nil {
+		return nil, f.mgmtErr
+	}
+	if f.mgmt != nil {
+		return f.mgmt, nil
+	}
+	return nil, errors.New("management commands aren't supported by the fake")
+}
+
+// testDataset returns a dataset whose primary result has a Timestamp and a Name column.
+func testDataset(rows ...[]value.Kusto) query.Dataset {
+	base := query.NewBaseDataset(context.Background(), kustoerrors.OpQuery, "PrimaryResult")
+	columns := []query.Column{
+		query.NewColumn(0, "Timestamp", types.DateTime),
+		query.NewColumn(1, "Name", types.String),
+	}
+	table := query.NewBaseTable(base, 0, "0", "PrimaryResult", "PrimaryResult", columns)
+
+	tableRows := make([]query.Row, len(rows))
+	for i, values := range rows {
+		tableRows[i] = query.NewRow(table, i, values)
+	}
+
+	return query.NewDataset(base, []query.Table{query.NewTable(table, tableRows)})
+}
+
+// countDataset returns a dataset whose primary result is the single Count row of a count query.
+func countDataset(count int64) query.Dataset {
+	base := query.NewBaseDataset(context.Background(), kustoerrors.OpQuery, "PrimaryResult")
+	columns := []query.Column{query.NewColumn(0, "Count", types.Long)}
+	table := query.NewBaseTable(base, 0, "0", "PrimaryResult", "PrimaryResult", columns)
+	row := query.NewRow(table, 0, []value.Kusto{value.NewLong(count)})
+
+	return query.NewDataset(base, []query.Table{query.NewTable(table, []query.Row{row})})
+}
+
+// secondaryTables returns the QueryProperties and QueryCompletionInformation tables
+// the iterative query API sends after the primary result.
+func secondaryTables() []query.Table {
+	base := query.NewBaseDataset(context.Background(), kustoerrors.OpQuery, "PrimaryResult")
+	columns := []query.Column{query.NewColumn(0, "Payload", types.String)}
+
+	var tables []query.Table
+	for i, kind := range []string{"QueryProperties", "QueryCompletionInformation"} {
+		table := query.NewBaseTable(base, int64(i+1), fmt.Sprint(i+1), "@ExtendedProperties", kind, columns)
+		row := query.NewRow(table, 0, []value.Kusto{value.NewString("{}")})
+		tables = append(tables, query.NewTable(table, []query.Row{row}))
+	}
+
+	return tables
+}
+
+func TestLastRowsQuery(t *testing.T) {
+	stmt, params := lastRowsQuery("Events", 7, timeRange{}, nil)
+
+	if got, want := stmt.String(), "table(tableName) | order by Timestamp desc | take rowLimit"; got != want {
+		t.Errorf("query = %q, want %q", got, want)
+	}
+
+	got := params.ToParameterCollection()
+	want := map[string]string{"tableName": `"Events"`, "rowLimit": "long(7)"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("parameter %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestLastRowsQueryColumns(t *testing.T) {
+	stmt, _ := lastRowsQuery("Events", 7, timeRange{}, []string{"Timestamp", "Message"})
+
+	if got, want := stmt.String(), "table(tableName) | order by Timestamp desc | take rowLimit | project Timestamp, Message"; got != want {
+		t.Errorf("query = %q, want %q", got, want)
+	}
+}
+
+func TestLastRowsQueryTimeRange(t *testing.T) {
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 1, 1, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		window     timeRange
+		wantFilter string
+		wantParams map[string]string
+	}{
+		{
+			name:       "from and to",
+			window:     timeRange{From: from, To: to},
+			wantFilter: "| where Timestamp between (fromTime .. toTime) |",
+			wantParams: map[string]string{"fromTime": "datetime(2024-06-01T00:00:00Z)", "toTime": "datetime(2024-06-01T01:30:00Z)"},
+		},
+		{
+			name:       "from only",
+			window:     timeRange{From: from},
+			wantFilter: "| where Timestamp >= fromTime |",
+			wantParams: map[string]string{"fromTime": "datetime(2024-06-01T00:00:00Z)"},
+		},
+		{
+			name:       "to only",
+			window:     timeRange{To: to},
+			wantFilter: "| where Timestamp <= toTime |",
+			wantParams: map[string]string{"toTime": "datetime(2024-06-01T01:30:00Z)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, params := lastRowsQuery("Events", 7, tt.window, nil)
+
+			if !strings.Contains(stmt.String(), tt.wantFilter) {
+				t.Errorf("query = %q, want it to contain %q", stmt.String(), tt.wantFilter)
+			}
+
+			got := params.ToParameterCollection()
+			for k, v := range tt.wantParams {
+				if got[k] != v {
+					t.Errorf("parameter %s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryTimeRange(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		since   time.Duration
+		from    time.Time
+		to      time.Time
+		want    timeRange
+		wantErr string
+	}{
+		{name: "unset"},
+		{name: "since", since: time.Hour, want: timeRange{From: now.Add(-time.Hour), To: now}},
+		{name: "from and to", from: from, to: to, want: timeRange{From: from, To: to}},
+		{name: "since with from", since: time.Hour, from: from, wantErr: "since can't be combined with from or to"},
+		{name: "negative since", since: -time.Hour, wantErr: "must not be negative"},
+		{name: "from after to", from: to, to: from, wantErr: "is after to"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Since = tt.since
+			cfg.From = tt.from
+			cfg.To = tt.to
+
+			err := cfg.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			if got := queryTimeRange(cfg, now); got != tt.want {
+				t.Errorf("queryTimeRange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateColumn(t *testing.T) {
+	tests := []struct {
+		column  string
+		wantErr bool
+	}{
+		{column: "Timestamp"},
+		{column: "_id"},
+		{column: "col_2"},
+		{column: "2col", wantErr: true},
+		{column: "", wantErr: true},
+		{column: "a b", wantErr: true},
+		{column: "x | take 1000000", wantErr: true},
+		{column: `x"]; .drop table T`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			err := validateColumn(tt.column)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateColumn(%q) error = %v, wantErr %v", tt.column, err, tt.wantErr)
+			}
+
+			cfg := testConfig()
+			cfg.Columns = []string{tt.column}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueryNonIterative(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 12, 30, 45, 0, time.UTC)
+	dataset := testDataset(
+		[]value.Kusto{value.NewDateTime(ts), value.NewString("first")},
+		[]value.Kusto{value.NewNullDateTime(), value.NewString("second, with a comma")},
+	)
+
+	tests := []struct {
+		name    string
+		output  OutputFormat
+		columns []string
+		want    string
+	}{
+		{
+			name:   "csv",
+			output: CSVOutput,
+			want:   "Timestamp,Name\n2024-06-01T12:30:45Z,first\n,\"second, with a comma\"\n",
+		},
+		{
+			name:   "json",
+			output: JSONOutput,
+			want:   `{"Name":"first","Timestamp":"2024-06-01T12:30:45Z"}` + "\n" + `{"Name":"second, with a comma","Timestamp":null}` + "\n",
+		},
+		{
+			name:    "projected csv",
+			output:  CSVOutput,
+			columns: []string{"Timestamp", "Name"},
+			want:    "Timestamp,Name\n2024-06-01T12:30:45Z,first\n,\"second, with a comma\"\n",
+		},
+		{
+			name:    "projected json",
+			output:  JSONOutput,
+			columns: []string{"Timestamp", "Name"},
+			want:    `{"Name":"first","Timestamp":"2024-06-01T12:30:45Z"}` + "\n" + `{"Name":"second, with a comma","Timestamp":null}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cfg := testConfig()
+			cfg.NonIterative = true
+			cfg.Output = tt.output
+			cfg.Columns = tt.columns
+			cfg.Out = &out
+
+			querier := &fakeQuerier{dataset: dataset}
+			if err := Query(context.Background(), querier, cfg); err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+
+			if querier.db != cfg.Database {
+				t.Errorf("Query() queried database %q, want %q", querier.db, cfg.Database)
+			}
+			if !strings.HasPrefix(querier.query, "table(tableName)") {
+				t.Errorf("Query() ran %q, want the parameterized last rows query", querier.query)
+			}
+			if projected := strings.Contains(querier.query, "| project "); projected != (len(tt.columns) > 0) {
+				t.Errorf("Query() ran %q, want projected = %v", querier.query, len(tt.columns) > 0)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Query() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryIterative(t *testing.T) {
+	var rows [][]value.Kusto
+	for i := 0; i < 5; i++ {
+		rows = append(rows, []value.Kusto{value.NewNullDateTime(), value.NewString(fmt.Sprintf("row %d", i))})
+	}
+
+	tests := []struct {
+		name        string
+		pageSize    int
+		secondary   []query.Table
+		afterErr    error
+		cancel      bool
+		wantRows    int
+		wantSkipped int
+		wantErr     string
+	}{
+		{name: "one page", wantRows: 5},
+		{name: "several pages", pageSize: 2, wantRows: 5},
+		{
+			name:        "secondary tables are drained",
+			pageSize:    2,
+			secondary:   secondaryTables(),
+			wantRows:    5,
+			wantSkipped: 2,
+		},
+		{
+			name:        "secondary tables are drained after cancelling",
+			pageSize:    2,
+			secondary:   secondaryTables(),
+			cancel:      true,
+			wantRows:    2,
+			wantSkipped: 2,
+			wantErr:     "cancelled after 2 rows",
+		},
+		{
+			name:     "error after the primary result",
+			afterErr: errors.New("query limits exceeded"),
+			wantRows: 5,
+			wantErr:  "query limits exceeded",
+		},
+		{name: "cancelled between pages", pageSize: 2, cancel: true, wantRows: 2, wantErr: "cancelled after 2 rows"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cfg := testConfig()
+			cfg.Output = JSONOutput
+			cfg.Out = &out
+			cfg.PageSize = tt.pageSize
+
+			dataset := newFakeIterativeDataset(testDataset(rows...), tt.secondary, tt.afterErr)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			err := Query(ctx, &fakeQuerier{iterative: dataset}, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Query() error = %v, want one containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+
+			if got := strings.Count(out.String(), "\n"); got != tt.wantRows {
+				t.Errorf("Query() wrote %d rows, want %d", got, tt.wantRows)
+			}
+			if dataset.skipped != tt.wantSkipped {
+				t.Errorf("Query() skipped %d secondary tables, want %d", dataset.skipped, tt.wantSkipped)
+			}
+			if len(dataset.tables) != 0 {
+				t.Errorf("Query() left %d tables unread, want none", len(dataset.tables))
+			}
+			if !dataset.closed {
+				t.Error("Query() didn't close the dataset")
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		wantRun bool
+	}{
+		{name: "management command", command: ".show tables", wantRun: true},
+		{name: "leading whitespace", command: "  .show version", wantRun: true},
+		{name: "query", command: "ravpateTable | take 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			querier := &fakeQuerier{}
+			// The fake can't return a management result, so every command fails;
+			// what matters is whether it was sent.
+			if err := Command(context.Background(), querier, testConfig(), tt.command); err == nil {
+				t.Fatal("Command() error = nil, want an error")
+			}
+
+			if ran := querier.query != ""; ran != tt.wantRun {
+				t.Errorf("Command() sent command = %v, want %v", ran, tt.wantRun)
+			}
+			if tt.wantRun && querier.query != tt.command {
+				t.Errorf("Command() sent %q, want %q", querier.query, tt.command)
+			}
+		})
+	}
+}
+
+func TestCheckTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		table   string
+		mgmtErr error
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "missing table",
+			table:   "Evnets",
+			mgmtErr: errors.New("Request is invalid and cannot be executed: EntityNotFoundException: Entity ID 'Evnets' of kind 'Table' was not found."),
+			want:    ".show table ['Evnets'] schema",
+			wantErr: "doesn't exist",
+		},
+		{
+			name:    "other failure",
+			table:   "Events",
+			mgmtErr: errors.New("forbidden"),
+			want:    ".show table ['Events'] schema",
+			wantErr: "error checking table",
+		},
+		{
+			name:    "quotes are escaped",
+			table:   "It's",
+			mgmtErr: errors.New("forbidden"),
+			want:    `.show table ['It\'s'] schema`,
+			wantErr: "forbidden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Table = tt.table
+
+			querier := &fakeQuerier{mgmtErr: tt.mgmtErr}
+			err := CheckTable(context.Background(), querier, cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckTable() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if querier.query != tt.want {
+				t.Errorf("CheckTable() sent %q, want %q", querier.query, tt.want)
+			}
+		})
+	}
+}
+
+// cslSchemaDataset returns the result of .show table cslschema for a table with schema.
+func cslSchemaDataset(t *testing.T, schema string) v1.Dataset {
+	t.Helper()
+
+	response := fmt.Sprintf(`{"Tables":[{"TableName":"Table_0","Columns":[{"ColumnName":"TableName","DataType":"String"},{"ColumnName":"Schema","DataType":"String"}],"Rows":[["ravpateTable",%q]]}]}`, schema)
+	dataset, err := v1.NewDatasetFromReader(context.Background(), kustoerrors.OpMgmt, io.NopCloser(strings.NewReader(response)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dataset
+}
+
+func TestCheckColumns(t *testing.T) {
+	const schema = "Timestamp:datetime,Name:string,['Odd name']:long"
+
+	tests := []struct {
+		name    string
+		columns []string
+		schema  string
+		mgmtErr error
+		wantErr string
+	}{
+		{name: "timestamp only"},
+		{name: "projected columns", columns: []string{"Name", "Timestamp"}},
+		{name: "mistyped column", columns: []string{"Nmae"}, wantErr: "column Nmae not found in table \"ravpateTable\", which has columns Timestamp, Name, ['Odd name']"},
+		{name: "no timestamp", schema: "Name:string", wantErr: "column Timestamp not found"},
+		{
+			name:    "missing table",
+			mgmtErr: errors.New("Request is invalid and cannot be executed: EntityNotFoundException: Entity ID 'ravpateTable' of kind 'Table' was not found."),
+			wantErr: "doesn't exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Columns = tt.columns
+			if tt.schema == "" {
+				tt.schema = schema
+			}
+
+			querier := &fakeQuerier{mgmt: cslSchemaDataset(t, tt.schema), mgmtErr: tt.mgmtErr}
+			err := CheckColumns(context.Background(), querier, cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckColumns() error = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckColumns() error = %v, want one containing %q", err, tt.wantErr)
+			}
+
+			if want := ".show table ['ravpateTable'] cslschema"; querier.query != want {
+				t.Errorf("CheckColumns() sent %q, want %q", querier.query, want)
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		output OutputFormat
+		want   string
+	}{
+		{name: "csv", output: CSVOutput, want: "count\n42\n"},
+		{name: "json", output: JSONOutput, want: `{"table":"ravpateTable","count":42}` + "\n"},
+		{name: "log", output: LogOutput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cfg := testConfig()
+			cfg.Output = tt.output
+			cfg.Out = &out
+
+			querier := &fakeQuerier{dataset: countDataset(42)}
+			if err := Count(context.Background(), querier, cfg); err != nil {
+				t.Fatalf("Count() error = %v", err)
+			}
+
+			if want := "table(tableName) | count"; querier.query != want {
+				t.Errorf("Count() ran %q, want %q", querier.query, want)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Count() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRequestID(t *testing.T) {
+	cfg := testConfig()
+	cfg.RequestID = "my-app;1234"
+	if got := clientRequestID(cfg); got != cfg.RequestID {
+		t.Errorf("clientRequestID() = %q, want %q", got, cfg.RequestID)
+	}
+
+	cfg.RequestID = ""
+	first, second := clientRequestID(cfg), clientRequestID(cfg)
+	if !strings.HasPrefix(first, "go-kusto-test;") {
+		t.Errorf("clientRequestID() = %q, want a go-kusto-test;<GUID> ID", first)
+	}
+	if first == second {
+		t.Errorf("clientRequestID() returned %q twice, want a new ID for each query", first)
+	}
+}
+
+func TestSeparateDatabases(t *testing.T) {
+	cfg := testConfig()
+	if cfg.IngestDB() != cfg.Database || cfg.QueryDB() != cfg.Database {
+		t.Errorf("IngestDB(), QueryDB() = %q, %q, want both to fall back to %q", cfg.IngestDB(), cfg.QueryDB(), cfg.Database)
+	}
+
+	cfg.IngestDatabase, cfg.QueryDatabase = "Staging", "Reporting"
+	cfg.NonIterative = true
+	cfg.Out = io.Discard
+
+	querier := &fakeQuerier{dataset: testDataset()}
+	if err := Query(context.Background(), querier, cfg); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if querier.db != "Reporting" {
+		t.Errorf("Query() queried database %q, want the query database", querier.db)
+	}
+
+	querier = &fakeQuerier{mgmtErr: errors.New("EntityNotFoundException: Entity ID 'ravpateTable' of kind 'Table' was not found.")}
+	err := CheckTable(context.Background(), querier, cfg)
+	if querier.db != "Staging" || err == nil || !strings.Contains(err.Error(), `database "Staging"`) {
+		t.Errorf("CheckTable() checked database %q with error %v, want the ingest database", querier.db, err)
+	}
+}
@@ -0,0 +1,115 @@
+package kustoclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+)
+
+// rawMu serializes the lines written for cfg.Raw, as ingestions can complete concurrently.
+var rawMu sync.Mutex
+
+// writeRaw writes v to cfg.Out as a line of JSON, for cfg.Raw.
+func writeRaw(cfg Config, v any) error {
+	rawMu.Lock()
+	defer rawMu.Unlock()
+
+	return json.NewEncoder(outputWriter(cfg)).Encode(v)
+}
+
+// rawTable is a table of a query response as written by cfg.Raw: the primary result, or one
+// of the tables following it, such as QueryProperties and QueryCompletionInformation.
+type rawTable struct {
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	Kind    string      `json:"kind"`
+	Columns []rawColumn `json:"columns"`
+	Rows    [][]any     `json:"rows"`
+}
+
+type rawColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// newRawTable converts table to a rawTable, with values converted as for JSONOutput.
+func newRawTable(table query.Table) rawTable {
+	raw := rawTable{ID: table.Id(), Name: table.Name(), Kind: table.Kind(), Columns: []rawColumn{}, Rows: [][]any{}}
+	for _, column := range table.Columns() {
+		raw.Columns = append(raw.Columns, rawColumn{Name: column.Name(), Type: string(column.Type())})
+	}
+
+	for _, row := range table.Rows() {
+		values := make([]any, len(row.Values()))
+		for i, v := range row.Values() {
+			values[i] = jsonValue(v)
+		}
+		raw.Rows = append(raw.Rows, values)
+	}
+
+	return raw
+}
+
+// queryRaw runs stmt with the non-iterative query API, which returns every table of the
+// response at once, and writes each table to cfg.Out as a rawTable. It returns the number
+// of primary result rows.
+func queryRaw(ctx context.Context, client Querier, cfg Config, stmt azkustodata.Statement, options ...azkustodata.QueryOption) (int, error) {
+	dataset, err := client.Query(ctx, cfg.QueryDB(), stmt, options...)
+	if err != nil {
+		return 0, fmt.Errorf("error querying dataset: %w", err)
+	}
+
+	rows := 0
+	for _, table := range dataset.Tables() {
+		raw := newRawTable(table)
+		if err := writeRaw(cfg, raw); err != nil {
+			return rows, fmt.Errorf("error writing table %s: %w", table.Name(), err)
+		}
+		if table.IsPrimaryResult() {
+			rows += len(raw.Rows)
+		}
+	}
+
+	return rows, nil
+}
+
+// rawStatus is the status record of an ingestion as written by cfg.Raw.
+type rawStatus struct {
+	Source       string         `json:"source"`
+	StatusRecord map[string]any `json:"statusRecord"`
+}
+
+// writeRawStatus writes the status record the SDK returned for the ingestion of source to
+// cfg.Out as a rawStatus. The SDK only returns the records of ingestions that didn't succeed.
+func writeRawStatus(cfg Config, source string, record error) error {
+	// The record's type is unexported, but its fields aren't, so it marshals as they are.
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding status record: %w", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("error encoding status record: %w", err)
+	}
+
+	// The source path of a blob can carry its SAS, which is a credential.
+	if path, ok := fields["IngestionSourcePath"].(string); ok {
+		if u, err := url.Parse(path); err == nil {
+			fields["IngestionSourcePath"] = redactBlobURL(u)
+		} else {
+			fields["IngestionSourcePath"] = ""
+		}
+	}
+
+	if err := writeRaw(cfg, rawStatus{Source: source, StatusRecord: fields}); err != nil {
+		return fmt.Errorf("error writing status record: %w", err)
+	}
+
+	return nil
+}
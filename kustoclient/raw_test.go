@@ -0,0 +1,79 @@
+package kustoclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+	"github.com/Azure/azure-kusto-go/azkustodata/query"
+	"github.com/Azure/azure-kusto-go/azkustodata/types"
+	"github.com/Azure/azure-kusto-go/azkustodata/value"
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+func TestQueryRaw(t *testing.T) {
+	ts := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	primary := testDataset([]value.Kusto{value.NewDateTime(ts), value.NewString("a")})
+
+	// The completion information follows the primary result.
+	base := query.NewBaseDataset(context.Background(), kustoerrors.OpQuery, "PrimaryResult")
+	completion := query.NewBaseTable(base, 1, "1", "QueryCompletionInformation", "QueryCompletionInformation", []query.Column{query.NewColumn(0, "EventTypeName", types.String)})
+	tables := append(primary.Tables(), query.NewTable(completion, []query.Row{query.NewRow(completion, 0, []value.Kusto{value.NewString("QueryInfo")})}))
+
+	var out bytes.Buffer
+	cfg := testConfig()
+	cfg.Out = &out
+	querier := &fakeQuerier{dataset: query.NewDataset(base, tables)}
+
+	rows, err := queryRaw(context.Background(), querier, cfg, kql.New("print 1"))
+	if err != nil {
+		t.Fatalf("queryRaw() error = %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("queryRaw() = %d rows, want 1", rows)
+	}
+
+	want := `{"id":"0","name":"PrimaryResult","kind":"PrimaryResult","columns":[{"name":"Timestamp","type":"datetime"},{"name":"Name","type":"string"}],"rows":[["2024-06-01T12:00:00Z","a"]]}
+{"id":"1","name":"QueryCompletionInformation","kind":"QueryCompletionInformation","columns":[{"name":"EventTypeName","type":"string"}],"rows":[["QueryInfo"]]}
+`
+	if out.String() != want {
+		t.Errorf("queryRaw() wrote\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestWriteRawStatus(t *testing.T) {
+	record := azkustoingest.StatusFromMapForTests(map[string]any{
+		"Status":              "Failed",
+		"FailureStatus":       "Permanent",
+		"ErrorCode":           "BadRequest_InvalidMapping",
+		"Details":             "column Name isn't in the data",
+		"IngestionSourcePath": "https://account.blob.core.windows.net/container/data.csv?sig=secret",
+	})
+
+	var out bytes.Buffer
+	cfg := testConfig()
+	cfg.Out = &out
+	if err := writeRawStatus(cfg, "data.csv", record); err != nil {
+		t.Fatalf("writeRawStatus() error = %v", err)
+	}
+
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("writeRawStatus() wrote the SAS: %s", out.String())
+	}
+
+	var got rawStatus
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("writeRawStatus() wrote invalid JSON %q: %v", out.String(), err)
+	}
+	if got.Source != "data.csv" || got.StatusRecord["ErrorCode"] != "BadRequest_InvalidMapping" || got.StatusRecord["Details"] != "column Name isn't in the data" {
+		t.Errorf("writeRawStatus() wrote %+v, want the record's fields", got)
+	}
+	if path := got.StatusRecord["IngestionSourcePath"]; path != "https://account.blob.core.windows.net/container/data.csv" {
+		t.Errorf("writeRawStatus() source path = %v, want it without the SAS", path)
+	}
+}
@@ -0,0 +1,166 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	kustoerrors "github.com/Azure/azure-kusto-go/azkustodata/errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a transient failure is retried
+	// when the -max-retries flag is not provided.
+	DefaultMaxRetries = 3
+
+	// retryBaseDelay is the delay before the first retry; it doubles on each attempt.
+	retryBaseDelay = 1 * time.Second
+
+	// retryMaxDelay caps the delay between two attempts.
+	retryMaxDelay = 30 * time.Second
+
+	// retryAfterMaxDelay caps a delay asked for by a throttling response, so that a bogus
+	// hint can't stall the run.
+	retryAfterMaxDelay = 5 * time.Minute
+)
+
+// transientStatusCodes are the HTTP status codes worth retrying.
+var transientStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:     true,
+	http.StatusTooManyRequests:    true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// withRetry calls fn until it succeeds, returns a permanent error, or has been retried maxRetries times.
+// Delays between attempts grow exponentially with jitter, unless a throttling response says how long
+// to wait, and waiting stops as soon as ctx is done.
+func withRetry(ctx context.Context, name string, maxRetries int, fn func() error) error {
+	return retryIf(ctx, name, maxRetries, isTransient, fn)
+}
+
+// retryIf is withRetry, retrying the errors that retryable reports true for.
+func retryIf(ctx context.Context, name string, maxRetries int, retryable func(error) bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= maxRetries || !retryable(err) {
+			return err
+		}
+
+		delay, throttled := retryAfter(err)
+		if throttled {
+			logger.Warn("Operation throttled, retrying after the delay the service asked for", "operation", name, "attempt", attempt+1, "maxAttempts", maxRetries+1, "delay", delay.String(), "error", err)
+		} else {
+			delay = backoffDelay(attempt)
+			logger.Warn("Operation failed, retrying", "operation", name, "attempt", attempt+1, "maxAttempts", maxRetries+1, "delay", delay.String(), "error", err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s cancelled while waiting to retry: %w", name, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// backoffDelay returns the delay before the retry following the given attempt,
+// picked at random from the upper half of the exponential window.
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter returns the delay a throttling or unavailable response in err asks for in its
+// Retry-After, Retry-After-Ms or x-ms-retry-after-ms header, capped at retryAfterMaxDelay.
+// Only responses from the Azure SDK keep their headers: the Kusto client's errors carry just the
+// status code, so retries of Kusto requests fall back to the exponential backoff.
+func retryAfter(err error) (time.Duration, bool) {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.RawResponse == nil {
+		return 0, false
+	}
+
+	delay, ok := parseRetryAfter(respErr.RawResponse.Header, time.Now())
+	if !ok {
+		return 0, false
+	}
+
+	return min(delay, retryAfterMaxDelay), true
+}
+
+// parseRetryAfter reads the delay asked for by the retry headers in h. Retry-After-Ms and
+// x-ms-retry-after-ms are in milliseconds, and Retry-After in seconds or an HTTP date,
+// which is relative to now.
+func parseRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	for _, name := range []string{"Retry-After-Ms", "X-Ms-Retry-After-Ms"} {
+		if ms, err := strconv.Atoi(h.Get(name)); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+	}
+
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now), true
+	}
+
+	return 0, false
+}
+
+// isTransient reports whether err is a throttling, availability or timeout error that may succeed on retry.
+// Anything unrecognised, including bad requests and authentication failures, is treated as permanent.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) {
+		return false
+	}
+
+	var httpErr *kustoerrors.HttpError
+	if errors.As(err, &httpErr) {
+		return transientStatusCodes[httpErr.StatusCode]
+	}
+
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return transientStatusCodes[respErr.StatusCode]
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,76 @@
+package kustoclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+		wantOK  bool
+	}{
+		{name: "no header"},
+		{name: "seconds", headers: map[string]string{"Retry-After": "7"}, want: 7 * time.Second, wantOK: true},
+		{name: "http date", headers: map[string]string{"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat)}, want: 90 * time.Second, wantOK: true},
+		{name: "http date in the past", headers: map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)}},
+		{name: "milliseconds", headers: map[string]string{"Retry-After-Ms": "250"}, want: 250 * time.Millisecond, wantOK: true},
+		{name: "ms header", headers: map[string]string{"x-ms-retry-after-ms": "1500"}, want: 1500 * time.Millisecond, wantOK: true},
+		{name: "milliseconds preferred", headers: map[string]string{"Retry-After": "10", "Retry-After-Ms": "500"}, want: 500 * time.Millisecond, wantOK: true},
+		{name: "zero", headers: map[string]string{"Retry-After": "0"}},
+		{name: "garbage", headers: map[string]string{"Retry-After": "soon"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for name, value := range tt.headers {
+				h.Set(name, value)
+			}
+
+			got, ok := parseRetryAfter(h, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	throttled := func(retryAfter string) error {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		resp.Header.Set("Retry-After", retryAfter)
+		return fmt.Errorf("error uploading blob: %w", &azcore.ResponseError{StatusCode: resp.StatusCode, RawResponse: resp})
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "throttled", err: throttled("3"), want: 3 * time.Second, wantOK: true},
+		{name: "capped", err: throttled("3600"), want: retryAfterMaxDelay, wantOK: true},
+		{name: "no hint", err: throttled("")},
+		{name: "no response", err: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}},
+		{name: "other error", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryAfter(tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package kustoclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+)
+
+// TableColumn is a column of a table created by CreateTable.
+type TableColumn struct {
+	Name string
+
+	// Type is the column's Kusto scalar type, such as datetime or string.
+	Type string
+}
+
+// kustoTypes maps the accepted Kusto scalar type names, aliases included, to the name
+// the type is created with.
+var kustoTypes = map[string]string{
+	"bool":     "bool",
+	"boolean":  "bool",
+	"datetime": "datetime",
+	"date":     "datetime",
+	"decimal":  "decimal",
+	"dynamic":  "dynamic",
+	"guid":     "guid",
+	"uuid":     "guid",
+	"uniqueid": "guid",
+	"int":      "int",
+	"long":     "long",
+	"real":     "real",
+	"double":   "real",
+	"string":   "string",
+	"timespan": "timespan",
+	"time":     "timespan",
+}
+
+// ParseSchema parses a table schema given as a comma-separated list of name:type columns,
+// such as "Timestamp:datetime,FirstName:string,LastName:string". Names must be plain column
+// names, and types Kusto scalar types.
+func ParseSchema(spec string) ([]TableColumn, error) {
+	var columns []TableColumn
+	seen := map[string]bool{}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		name, typeName, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid schema column %q: must be name:type", field)
+		}
+
+		name = strings.TrimSpace(name)
+		if err := validateColumn(name); err != nil {
+			return nil, fmt.Errorf("invalid schema: %w", err)
+		}
+
+		columnType, ok := kustoTypes[strings.ToLower(strings.TrimSpace(typeName))]
+		if !ok {
+			return nil, fmt.Errorf("invalid schema column %q: unknown type %q, supported types are: %s", name, typeName, supportedColumnTypes())
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("invalid schema: column %q is listed more than once", name)
+		}
+		seen[name] = true
+
+		columns = append(columns, TableColumn{Name: name, Type: columnType})
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("invalid schema: no columns")
+	}
+
+	return columns, nil
+}
+
+// supportedColumnTypes returns the accepted type names, sorted, for error messages.
+func supportedColumnTypes() string {
+	names := make([]string, 0, len(kustoTypes))
+	for name := range kustoTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// CreateTable creates the configured table with the given columns, for bootstrapping a new
+// database. The table is created only if it doesn't exist: Kusto leaves one that already
+// does as it is, whatever its columns.
+func CreateTable(ctx context.Context, client Querier, cfg Config, columns []TableColumn) (err error) {
+	ctx, span := startSpan(ctx, "CreateTable", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrQuery, err)
+	}()
+
+	command, err := createTableCommand(cfg.Table, columns)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Creating table...", "database", cfg.IngestDB(), "table", cfg.Table, "command", command)
+	if _, err := client.Mgmt(ctx, cfg.IngestDB(), kql.New("").AddUnsafe(command)); err != nil {
+		return fmt.Errorf("error creating table %q: %w", cfg.Table, err)
+	}
+
+	return nil
+}
+
+// createTableCommand returns the command creating table with columns, unless it already
+// exists. Management commands can't take query parameters: the table name is quoted with
+// quoteTable, and the columns are checked to be plain names and known types.
+func createTableCommand(table string, columns []TableColumn) (string, error) {
+	if len(columns) == 0 {
+		return "", fmt.Errorf("no columns to create table %q with", table)
+	}
+
+	specs := make([]string, len(columns))
+	for i, column := range columns {
+		if err := validateColumn(column.Name); err != nil {
+			return "", err
+		}
+		columnType, ok := kustoTypes[strings.ToLower(column.Type)]
+		if !ok {
+			return "", fmt.Errorf("invalid column %q: unknown type %q", column.Name, column.Type)
+		}
+		specs[i] = column.Name + ":" + columnType
+	}
+
+	return fmt.Sprintf(".create table %s (%s) with (ifnotexists)", quoteTable(table), strings.Join(specs, ", ")), nil
+}
@@ -0,0 +1,73 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []TableColumn
+		wantErr string
+	}{
+		{
+			name: "columns",
+			spec: "Timestamp:datetime,FirstName:string,LastName:string",
+			want: []TableColumn{{"Timestamp", "datetime"}, {"FirstName", "string"}, {"LastName", "string"}},
+		},
+		{
+			name: "aliases and spaces",
+			spec: " Id : UUID, Elapsed:time, Score:double ,",
+			want: []TableColumn{{"Id", "guid"}, {"Elapsed", "timespan"}, {"Score", "real"}},
+		},
+		{name: "unknown type", spec: "Timestamp:datetime,Name:varchar", wantErr: `unknown type "varchar"`},
+		{name: "missing type", spec: "Timestamp", wantErr: "must be name:type"},
+		{name: "invalid name", spec: "First Name:string", wantErr: "invalid column"},
+		{name: "injected name", spec: "x:string); .drop table T //:string", wantErr: "invalid"},
+		{name: "duplicate column", spec: "Name:string,Name:long", wantErr: "listed more than once"},
+		{name: "empty", spec: " , ", wantErr: "no columns"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchema(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSchema() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchema() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSchema() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTable(t *testing.T) {
+	cfg := testConfig()
+	cfg.Table = "It's"
+
+	querier := &fakeQuerier{mgmtErr: errors.New("forbidden")}
+	columns := []TableColumn{{"Timestamp", "datetime"}, {"Name", "string"}}
+	err := CreateTable(context.Background(), querier, cfg, columns)
+	if err == nil || !strings.Contains(err.Error(), "error creating table") {
+		t.Fatalf("CreateTable() error = %v, want one containing %q", err, "error creating table")
+	}
+
+	if want := `.create table ['It\'s'] (Timestamp:datetime, Name:string) with (ifnotexists)`; querier.query != want {
+		t.Errorf("CreateTable() sent %q, want %q", querier.query, want)
+	}
+	if querier.db != cfg.Database {
+		t.Errorf("CreateTable() ran in database %q, want %q", querier.db, cfg.Database)
+	}
+}
@@ -0,0 +1,63 @@
+package kustoclient
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// sniffSize is how much of a reader sniffFormat looks at.
+const sniffSize = 4 << 10
+
+// sniffFormat guesses the format of the data in r from its first few KB: parquet or avro going
+// by their magic numbers, multijson for a JSON array or JSON objects spread over several lines,
+// json for one JSON object per line, and csv otherwise. It returns a reader replaying everything read from r, sniffed bytes included.
+func sniffFormat(r io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	sample, err := br.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return "", nil, err
+	}
+
+	return guessFormat(sample, len(sample) < sniffSize), br, nil
+}
+
+// guessFormat guesses the format of data starting with sample. complete is set when the
+// sample is all of the data, rather than cut off part way through a line.
+func guessFormat(sample []byte, complete bool) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte("PAR1")):
+		return "parquet"
+	case bytes.HasPrefix(sample, []byte("Obj\x01")):
+		return "avro"
+	}
+
+	sample = bytes.TrimPrefix(sample, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimLeft(sample, " \t\r\n")
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return "multijson"
+	case !bytes.HasPrefix(trimmed, []byte("{")):
+		return "csv"
+	}
+
+	lines := bytes.Split(trimmed, []byte("\n"))
+	if !complete && len(lines) > 1 {
+		// The last line is probably cut off.
+		lines = lines[:len(lines)-1]
+	}
+
+	for _, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '{' || line[len(line)-1] != '}' {
+			return "multijson"
+		}
+	}
+
+	return "json"
+}
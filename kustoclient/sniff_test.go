@@ -0,0 +1,46 @@
+package kustoclient
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "csv", input: "2024-06-01T00:00:00Z,Sql,Isgood\n", want: "csv"},
+		{name: "csv with header", input: "Timestamp,FirstName,LastName\n2024-06-01T00:00:00Z,Sql,Isgood\n", want: "csv"},
+		{name: "json lines", input: "{\"a\":1}\n{\"a\":2}\n", want: "json"},
+		{name: "json array", input: "  [{\"a\":1},\n{\"a\":2}]", want: "multijson"},
+		{name: "pretty printed objects", input: "{\n  \"a\": 1\n}\n{\n  \"a\": 2\n}\n", want: "multijson"},
+		{name: "byte order mark", input: "\xef\xbb\xbf{\"a\":1}\n", want: "json"},
+		{name: "json lines longer than the sample", input: strings.Repeat("{\"a\":\"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxx\"}\n", 500), want: "json"},
+		{name: "empty", input: "", want: "csv"},
+		{name: "parquet", input: "PAR1\x15\x04\x15", want: "parquet"},
+		{name: "avro", input: "Obj\x01\x04\x14avro.codec", want: "avro"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, r, err := sniffFormat(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("sniffFormat() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sniffFormat() = %q, want %q", got, tt.want)
+			}
+
+			replayed, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(replayed) != tt.input {
+				t.Errorf("sniffFormat() reader replayed %d bytes, want all %d", len(replayed), len(tt.input))
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+// IngestionError is returned for an ingestion that Kusto reports as failed or only partly
+// succeeded, carrying the fields of its status record.
+type IngestionError struct {
+	// Source is the file, blob or input that was ingested.
+	Source string
+
+	Status        azkustoingest.StatusCode
+	FailureStatus azkustoingest.FailureStatusCode
+	ErrorCode     string
+	Details       string
+}
+
+func (e *IngestionError) Error() string {
+	if e.Partial() {
+		return fmt.Sprintf("ingestion of %s only partly succeeded, some of its records were dropped (error code: %s): %s", e.Source, e.ErrorCode, e.Details)
+	}
+
+	return fmt.Sprintf("ingestion of %s finished with status %s (failure status: %s, error code: %s): %s",
+		e.Source, e.Status, e.FailureStatus, e.ErrorCode, e.Details)
+}
+
+// Partial reports whether some of the data was ingested despite the error. The status record
+// doesn't say which records were dropped, so ingesting the source again would duplicate the rest.
+func (e *IngestionError) Partial() bool {
+	return e.Status == azkustoingest.PartiallySucceeded
+}
+
+// Retryable reports whether ingesting the source again could succeed: nothing was ingested,
+// and Kusto reported the failure as transient.
+func (e *IngestionError) Retryable() bool {
+	return e.Status == azkustoingest.Failed && e.FailureStatus == azkustoingest.Transient
+}
+
+const (
+	// DefaultPollInterval is how long waitForIngestion waits before first reporting that an
+	// ingestion is still pending, when no interval is configured.
+	DefaultPollInterval = 5 * time.Second
+
+	// DefaultMaxPollInterval is the longest waitForIngestion goes between progress reports,
+	// when no maximum is configured.
+	DefaultMaxPollInterval = time.Minute
+)
+
+// waitForIngestion waits for the ingestion of source tracked by result to complete and logs its
+// final status. Until it completes, the pending ingestion is reported at intervals starting at
+// cfg.PollInterval and doubling up to cfg.MaxPollInterval. A failed or partially succeeded
+// ingestion is returned as an error carrying the status details.
+//
+// If ctx is done first, the ingestion is left to WaitPending to wait for, and an error is returned.
+func waitForIngestion(ctx context.Context, cfg Config, source string, result *azkustoingest.Result) error {
+	// Wait isn't given ctx itself: the SDK records a cancelled wait as the ingestion's final
+	// status, after which WaitPending couldn't wait for it again.
+	waitCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := result.Wait(waitCtx)
+
+	report := !cfg.NoProgress && logger.Enabled(ctx, slog.LevelInfo)
+	err := awaitStatus(ctx, done, cfg.PollInterval, cfg.MaxPollInterval, report)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		addPending(cfg, source, done, cancel)
+		return fmt.Errorf("stopped waiting for ingestion of %s: %w", source, ctx.Err())
+	}
+	cancel()
+
+	return ingestionOutcome(cfg, source, err)
+}
+
+// ingestAndWait submits the ingestion of source with submit, then waits for it to complete.
+// With cfg.RetryFailed, an ingestion that Kusto reports as failed transiently is submitted
+// again, up to cfg.MaxRetries times. Partly succeeded ingestions aren't, as they would duplicate
+// the records that were ingested: their *IngestionError is returned for the caller to handle.
+func ingestAndWait(ctx context.Context, cfg Config, source string, submit func() (*azkustoingest.Result, error)) error {
+	maxRetries := 0
+	if cfg.RetryFailed {
+		maxRetries = cfg.MaxRetries
+	}
+
+	return retryIf(ctx, "ingest "+source, maxRetries, isRetryableIngestion, func() error {
+		status, err := submit()
+		if err != nil {
+			return err
+		}
+
+		return waitForIngestion(ctx, cfg, source, status)
+	})
+}
+
+// isRetryableIngestion reports whether err is an *IngestionError that ingesting again could fix.
+func isRetryableIngestion(err error) bool {
+	var ingestionErr *IngestionError
+	return errors.As(err, &ingestionErr) && ingestionErr.Retryable()
+}
+
+// ingestionOutcome logs the final status of the ingestion of source, given the error its
+// Result.Wait returned, and returns the failure as an error if it didn't succeed. With
+// cfg.Raw, the status record of a failure is written out in full too.
+func ingestionOutcome(cfg Config, source string, err error) error {
+	if err == nil {
+		logger.Info("Ingestion completed", "source", source, "status", string(azkustoingest.Succeeded))
+		return nil
+	}
+
+	if !azkustoingest.IsStatusRecord(err) {
+		return fmt.Errorf("error waiting for ingest: %w", err)
+	}
+
+	logger.Debug("Ingestion status record", "source", source, "record", fmt.Sprintf("%+v", err))
+	if cfg.Raw {
+		if rawErr := writeRawStatus(cfg, source, err); rawErr != nil {
+			logger.Warn("Couldn't write the raw status record", "source", source, "error", rawErr)
+		}
+	}
+	ingestionErr := readIngestionStatus(source, err)
+	logger.Error("Ingestion completed", "source", source, "status", string(ingestionErr.Status), "failureStatus", string(ingestionErr.FailureStatus), "errorCode", ingestionErr.ErrorCode, "details", ingestionErr.Details)
+
+	return ingestionErr
+}
+
+// awaitStatus waits for the final status to arrive on done, and with report logs that the
+// ingestion is still pending at exponentially increasing intervals. The status table itself
+// is read by the SDK, which doesn't expose it, so the intervals only pace the progress reports.
+// If ctx is done before the status arrives, ctx.Err() is returned.
+func awaitStatus(ctx context.Context, done <-chan error, interval, maxInterval time.Duration, report bool) error {
+	if !report {
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = DefaultMaxPollInterval
+	}
+	interval = min(interval, maxInterval)
+
+	start := time.Now()
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			interval = min(interval*2, maxInterval)
+			logger.Info("Ingestion pending", "status", string(azkustoingest.Pending), "elapsed", time.Since(start).Round(time.Second).String(), "nextCheck", interval.String())
+			timer.Reset(interval)
+		}
+	}
+}
+
+// readIngestionStatus extracts the status fields from a status record returned by Result.Wait.
+func readIngestionStatus(source string, err error) *IngestionError {
+	status := &IngestionError{Source: source}
+	status.Status, _ = azkustoingest.GetIngestionStatus(err)
+	status.FailureStatus, _ = azkustoingest.GetIngestionFailureStatus(err)
+	status.ErrorCode, _ = azkustoingest.GetErrorCode(err)
+
+	// The SDK has no accessor for the details, but the record's fields are exported
+	// so they can still be read through reflection.
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Struct {
+		if details := v.FieldByName("Details"); details.IsValid() && details.Kind() == reflect.String {
+			status.Details = details.String()
+		}
+	}
+
+	return status
+}
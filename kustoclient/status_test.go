@@ -0,0 +1,125 @@
+package kustoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+func TestAwaitStatus(t *testing.T) {
+	want := errors.New("ingestion failed")
+
+	done := make(chan error, 1)
+	go func() {
+		// Outlast a few progress reports first.
+		time.Sleep(20 * time.Millisecond)
+		done <- want
+	}()
+
+	if err := awaitStatus(context.Background(), done, time.Millisecond, 4*time.Millisecond, true); err != want {
+		t.Errorf("awaitStatus() error = %v, want %v", err, want)
+	}
+}
+
+func TestAwaitStatusSucceeded(t *testing.T) {
+	done := make(chan error)
+	close(done)
+
+	if err := awaitStatus(context.Background(), done, 0, 0, true); err != nil {
+		t.Errorf("awaitStatus() error = %v, want nil", err)
+	}
+}
+
+func TestAwaitStatusCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, report := range []bool{true, false} {
+		if err := awaitStatus(ctx, make(chan error), time.Millisecond, time.Millisecond, report); !errors.Is(err, context.Canceled) {
+			t.Errorf("awaitStatus(report %v) error = %v, want %v", report, err, context.Canceled)
+		}
+	}
+}
+
+func TestIngestionError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           *IngestionError
+		wantPartial   bool
+		wantRetryable bool
+		wantMessage   string
+	}{
+		{
+			name:          "transient failure",
+			err:           &IngestionError{Source: "data.csv", Status: azkustoingest.Failed, FailureStatus: azkustoingest.Transient, ErrorCode: "General_InternalServerError", Details: "try again"},
+			wantRetryable: true,
+			wantMessage:   "ingestion of data.csv finished with status Failed (failure status: Transient, error code: General_InternalServerError): try again",
+		},
+		{
+			name:        "permanent failure",
+			err:         &IngestionError{Source: "data.csv", Status: azkustoingest.Failed, FailureStatus: azkustoingest.Permanent, ErrorCode: "BadRequest_EmptyBlob"},
+			wantMessage: "finished with status Failed",
+		},
+		{
+			name:        "partial success",
+			err:         &IngestionError{Source: "data.csv", Status: azkustoingest.PartiallySucceeded, FailureStatus: azkustoingest.Transient, ErrorCode: "Stream_WrongNumberOfFields", Details: "3 records dropped"},
+			wantPartial: true,
+			wantMessage: "ingestion of data.csv only partly succeeded, some of its records were dropped (error code: Stream_WrongNumberOfFields): 3 records dropped",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Partial(); got != tt.wantPartial {
+				t.Errorf("Partial() = %v, want %v", got, tt.wantPartial)
+			}
+			if got := tt.err.Retryable(); got != tt.wantRetryable {
+				t.Errorf("Retryable() = %v, want %v", got, tt.wantRetryable)
+			}
+			if got := isRetryableIngestion(fmt.Errorf("wrapped: %w", tt.err)); got != tt.wantRetryable {
+				t.Errorf("isRetryableIngestion() = %v, want %v", got, tt.wantRetryable)
+			}
+			if got := tt.err.Error(); !strings.Contains(got, tt.wantMessage) {
+				t.Errorf("Error() = %q, want it to contain %q", got, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestIngestAndWaitSubmitError(t *testing.T) {
+	want := errors.New("submit failed")
+
+	tests := []struct {
+		name        string
+		retryFailed bool
+	}{
+		{name: "without retry-failed"},
+		{name: "with retry-failed", retryFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RetryFailed = tt.retryFailed
+			cfg.MaxRetries = 3
+
+			// Failures to submit are retried by submit itself, not by ingestAndWait.
+			calls := 0
+			err := ingestAndWait(context.Background(), cfg, "data.csv", func() (*azkustoingest.Result, error) {
+				calls++
+				return nil, want
+			})
+			if !errors.Is(err, want) {
+				t.Errorf("ingestAndWait() error = %v, want %v", err, want)
+			}
+			if calls != 1 {
+				t.Errorf("submit called %d times, want 1", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package kustoclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest"
+)
+
+const (
+	// IngestByPrefix marks a tag that identifies an ingestion, so it can be skipped if the
+	// table already has data with the same tag.
+	IngestByPrefix = "ingest-by:"
+
+	// DropByPrefix marks a tag that the extents of an ingestion can later be dropped by.
+	DropByPrefix = "drop-by:"
+
+	// AutoIdempotencyKey, as Config.IdempotencyKey, makes the key of each ingestion the
+	// SHA-256 hash of its data, so that the same data is only ingested once.
+	AutoIdempotencyKey = "auto"
+)
+
+// validateTag checks that tag is an ingest-by: or drop-by: tag with a value.
+func validateTag(tag string) error {
+	var value string
+	switch {
+	case strings.HasPrefix(tag, IngestByPrefix):
+		value = strings.TrimPrefix(tag, IngestByPrefix)
+	case strings.HasPrefix(tag, DropByPrefix):
+		value = strings.TrimPrefix(tag, DropByPrefix)
+	default:
+		return fmt.Errorf("invalid tag %q: must start with %q or %q", tag, IngestByPrefix, DropByPrefix)
+	}
+
+	if value == "" {
+		return fmt.Errorf("invalid tag %q: value must not be empty", tag)
+	}
+
+	if strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("invalid tag %q: value must not contain whitespace", tag)
+	}
+
+	return nil
+}
+
+// metadataOptions returns the options attaching cfg.Tags and cfg.CreationTime to the ingested
+// extents, and skipping the ingestion if the cfg.IngestIfNotExists tag is already in the table,
+// followed by those setting cfg.Properties.
+func metadataOptions(cfg Config) ([]azkustoingest.FileOption, error) {
+	var opts []azkustoingest.FileOption
+
+	if len(cfg.Tags) > 0 {
+		for _, tag := range cfg.Tags {
+			if err := validateTag(tag); err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, azkustoingest.Tags(cfg.Tags))
+	}
+
+	if cfg.IngestIfNotExists != "" {
+		tag := IngestByPrefix + cfg.IngestIfNotExists
+		if err := validateTag(tag); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(cfg.Tags, tag) {
+			return nil, fmt.Errorf("ingest if not exists %q requires the %q tag, or later runs won't detect this one", cfg.IngestIfNotExists, tag)
+		}
+		opts = append(opts, azkustoingest.IfNotExists(cfg.IngestIfNotExists))
+	}
+
+	if !cfg.CreationTime.IsZero() {
+		opts = append(opts, azkustoingest.SetCreationTime(cfg.CreationTime))
+	}
+
+	if len(opts) > 0 && cfg.IngestMode == StreamingIngest {
+		return nil, fmt.Errorf("tags, ingest if not exists and creation time can't be used with streaming ingestion, use queued or managed ingestion instead")
+	}
+
+	propOpts, err := propertyOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, propOpts...)
+
+	return opts, nil
+}
+
+// validateIdempotencyKey checks that cfg.IdempotencyKey, if set, can tag the ingestions.
+func validateIdempotencyKey(cfg Config) error {
+	if cfg.IdempotencyKey == "" {
+		return nil
+	}
+
+	if cfg.IngestIfNotExists != "" {
+		return fmt.Errorf("an idempotency key and ingest if not exists can't be used together")
+	}
+
+	if cfg.IngestMode == StreamingIngest {
+		return fmt.Errorf("an idempotency key can't be used with streaming ingestion, use queued or managed ingestion instead")
+	}
+
+	if cfg.IdempotencyKey != AutoIdempotencyKey {
+		if err := validateTag(IngestByPrefix + cfg.IdempotencyKey); err != nil {
+			return fmt.Errorf("invalid idempotency key %q: %w", cfg.IdempotencyKey, err)
+		}
+	}
+
+	return nil
+}
+
+// withIdempotencyKey returns cfg with the ingestion tagged ingest-by:<key> and skipped if the
+// table already has data with that tag. When cfg.IdempotencyKey is AutoIdempotencyKey, the key
+// is the contentKey of the data read by open, which isn't called otherwise.
+//
+// Kusto checks the tag when it processes the ingestion, not when it is queued, so this makes
+// ingestions at most once across retries and re-runs that start after an earlier attempt
+// was ingested. Two attempts queued together can still both be ingested.
+func withIdempotencyKey(cfg Config, open func() (io.ReadCloser, error)) (Config, error) {
+	key := cfg.IdempotencyKey
+	if key == "" {
+		return cfg, nil
+	}
+
+	if key == AutoIdempotencyKey {
+		r, err := open()
+		if err != nil {
+			return cfg, fmt.Errorf("error hashing data for its idempotency key: %w", err)
+		}
+		key, err = contentKey(r)
+		if closeErr := r.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return cfg, fmt.Errorf("error hashing data for its idempotency key: %w", err)
+		}
+	}
+	logger.Debug("Ingesting with idempotency key", "key", key)
+
+	if tag := IngestByPrefix + key; !slices.Contains(cfg.Tags, tag) {
+		cfg.Tags = append(slices.Clip(cfg.Tags), tag)
+	}
+	cfg.IngestIfNotExists = key
+
+	return cfg, nil
+}
+
+// contentKey returns the idempotency key of the data read from r: its hex SHA-256 hash,
+// prefixed with sha256- to say how it was made.
+func contentKey(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return "sha256-" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openFile returns a function opening the file at path, for withIdempotencyKey to hash.
+func openFile(path string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return os.Open(path) }
+}
+
+// openBytes returns a function reading data, for withIdempotencyKey to hash.
+func openBytes(data []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+}
@@ -0,0 +1,84 @@
+package kustoclient
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestContentKey(t *testing.T) {
+	key := func(data string) string {
+		t.Helper()
+		k, err := contentKey(strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	// Keys must never change for the same data, or re-runs of earlier ingestions would go undetected.
+	const want = "sha256-492d5ea496056f1a6a6592241032fab764c321596317930b4fa0e1e8bc3b7470"
+	if got := key("a,b\n1,2\n"); got != want {
+		t.Errorf("contentKey() = %q, want %q", got, want)
+	}
+	if key("a,b\n1,2\n") != key("a,b\n1,2\n") {
+		t.Error("contentKey() differs for identical content")
+	}
+	if key("a,b\n1,2\n") == key("a,b\n1,3\n") {
+		t.Error("contentKey() is the same for different content")
+	}
+	if err := validateTag(IngestByPrefix + want); err != nil {
+		t.Errorf("contentKey() isn't a valid tag value: %v", err)
+	}
+}
+
+func TestWithIdempotencyKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fileKey, err := contentKey(strings.NewReader("a,b\n1,2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		tags []string
+		want string
+	}{
+		{name: "off", tags: []string{"drop-by:2024-06"}},
+		{name: "key", key: "batch-1", tags: []string{"drop-by:2024-06"}, want: "batch-1"},
+		{name: "key already tagged", key: "batch-1", tags: []string{"ingest-by:batch-1"}, want: "batch-1"},
+		{name: "auto", key: AutoIdempotencyKey, want: fileKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.IdempotencyKey, cfg.Tags = tt.key, tt.tags
+
+			got, err := withIdempotencyKey(cfg, openFile(path))
+			if err != nil {
+				t.Fatalf("withIdempotencyKey() error = %v", err)
+			}
+
+			if got.IngestIfNotExists != tt.want {
+				t.Errorf("withIdempotencyKey() skips if %q exists, want %q", got.IngestIfNotExists, tt.want)
+			}
+			wantTags := tt.tags
+			if tt.want != "" && !slices.Contains(wantTags, IngestByPrefix+tt.want) {
+				wantTags = append(slices.Clone(wantTags), IngestByPrefix+tt.want)
+			}
+			if !slices.Equal(got.Tags, wantTags) {
+				t.Errorf("withIdempotencyKey() tags = %v, want %v", got.Tags, wantTags)
+			}
+			if _, err := metadataOptions(got); err != nil {
+				t.Errorf("withIdempotencyKey() config doesn't ingest: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package kustoclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// tokenExpiryMargin is how long a cached token must remain valid for to be reused,
+// so that it doesn't expire part way through a run.
+const tokenExpiryMargin = 5 * time.Minute
+
+// cachedToken is a bearer token as stored in the token cache file.
+type cachedToken struct {
+	Token     string    `json:"token"`
+	ExpiresOn time.Time `json:"expiresOn"`
+}
+
+// tokenCachePath returns the path of the token cache file in the user's config directory.
+func tokenCachePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the token cache directory: %w", err)
+	}
+
+	return filepath.Join(dir, "go-kusto-test", "tokens.json"), nil
+}
+
+// tokenCacheKey returns the key a token for the cluster, requested with the given scopes,
+// is cached under. Tokens for the cluster's default scope are keyed by its URL alone.
+func tokenCacheKey(kustoURL string, scopes []string) string {
+	if len(scopes) == 0 {
+		return kustoURL
+	}
+
+	return kustoURL + " " + strings.Join(scopes, " ")
+}
+
+// readTokenCache reads the cached tokens, keyed by tokenCacheKey, from path.
+// A missing cache file is treated as an empty cache.
+func readTokenCache(path string) (map[string]cachedToken, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]cachedToken{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token cache %q: %w", path, err)
+	}
+
+	tokens := map[string]cachedToken{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("error parsing token cache %q: %w", path, err)
+	}
+
+	return tokens, nil
+}
+
+// loadCachedToken returns the token cached under key, if there is one that isn't about to expire.
+func loadCachedToken(path, key string) (*azcore.AccessToken, bool) {
+	tokens, err := readTokenCache(path)
+	if err != nil {
+		logger.Warn("Ignoring unreadable token cache", "error", err)
+		return nil, false
+	}
+
+	cached, ok := tokens[key]
+	if !ok || time.Until(cached.ExpiresOn) < tokenExpiryMargin {
+		return nil, false
+	}
+
+	return &azcore.AccessToken{Token: cached.Token, ExpiresOn: cached.ExpiresOn}, true
+}
+
+// storeCachedToken saves the token under key in the cache at path, dropping expired entries.
+// The cache is only readable by the current user, and replaced atomically so a concurrent
+// run never sees a partially written file.
+func storeCachedToken(path, key string, token *azcore.AccessToken) error {
+	tokens, err := readTokenCache(path)
+	if err != nil {
+		tokens = map[string]cachedToken{}
+	}
+
+	for k, cached := range tokens {
+		if time.Now().After(cached.ExpiresOn) {
+			delete(tokens, k)
+		}
+	}
+	tokens[key] = cachedToken{Token: token.Token, ExpiresOn: token.ExpiresOn}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("error encoding token cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating token cache directory: %w", err)
+	}
+
+	// CreateTemp creates the file with 0600 permissions.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tokens-*.json")
+	if err != nil {
+		return fmt.Errorf("error creating token cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing token cache: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing token cache: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing token cache: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package kustoclient
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the package's spans. It uses the global tracer provider,
+// which doesn't record anything until the application installs one.
+var tracer = otel.Tracer("go-kusto-test/kustoclient")
+
+// startSpan starts a span for the named operation, tagged with the cluster, the databases
+// ingested into and queried, and the table of cfg.
+func startSpan(ctx context.Context, name string, cfg Config) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("kusto.cluster", cfg.ClusterURL),
+		attribute.String("kusto.ingest_database", cfg.IngestDB()),
+		attribute.String("kusto.query_database", cfg.QueryDB()),
+		attribute.String("kusto.table", cfg.Table),
+	))
+}
+
+// endSpan records err on span, if there was one, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
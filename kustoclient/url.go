@@ -0,0 +1,185 @@
+package kustoclient
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-kusto-go/azkustoingest/ingestoptions"
+)
+
+// maxErrorBodySize is the most of an error response's body fetchURL includes in its error.
+const maxErrorBodySize = 512
+
+// IngestURL fetches the data served at rawURL over HTTP or HTTPS and ingests it into the
+// configured table with IngestReader, going through cfg.ProxyURL and trusting cfg.CACertFile
+// if they are set. Gzip-encoded responses are decompressed transparently, and so is the data
+// of a .gz or .zip URL, which for a zip archive must hold a single file. The data is in
+// cfg.Format or, when that is empty, the format of the URL's extension, such as csv for
+// data.csv.gz, and is sniffed if the URL has none.
+func IngestURL(ctx context.Context, ingestor Ingestor, cfg Config, rawURL string) (err error) {
+	ctx, span := startSpan(ctx, "IngestURL", cfg)
+	defer func() {
+		endSpan(span, err)
+		err = categorize(ErrIngest, err)
+	}()
+
+	u, err := parseDataURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	// The query may hold a token, never log or return it.
+	redacted := redactBlobURL(u)
+
+	if err := checkCompression(u.Path); err != nil {
+		return err
+	}
+	compression, dataPath := fileCompression(u.Path)
+
+	if cfg.Format == "" {
+		ext := strings.TrimPrefix(strings.ToLower(path.Ext(dataPath)), ".")
+		if _, known := fileFormats[ext]; known {
+			cfg.Format = ext
+		}
+	}
+
+	logger.Info("Fetching data...", "url", redacted)
+	body, err := fetchURL(ctx, cfg, u, redacted)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	data, err := decompressBody(body, compression)
+	if err != nil {
+		return fmt.Errorf("error decompressing %s: %w", redacted, err)
+	}
+
+	return IngestReader(ctx, ingestor, cfg, data)
+}
+
+// decompressBody returns a reader of the data in body, compressed with compression going by
+// the URL's extension. A body that isn't compressed after all, as when the server sent it with
+// a gzip Content-Encoding the transport already decoded, is read as it is.
+func decompressBody(body io.Reader, compression ingestoptions.CompressionType) (io.Reader, error) {
+	if compression == ingestoptions.CTNone {
+		return body, nil
+	}
+
+	br := bufio.NewReader(body)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case compression == ingestoptions.GZIP && bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case compression == ingestoptions.ZIP && bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return unzipSingleFile(br)
+	}
+
+	return br, nil
+}
+
+// unzipSingleFile returns a reader of the single file in the zip archive read from r. The
+// archive is buffered, as its directory is at the end.
+func unzipSingleFile(r io.Reader) (io.Reader, error) {
+	archive, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*zip.File
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f)
+		}
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("zip archive holds %d files, only one can be ingested from a URL", len(files))
+	}
+
+	return files[0].Open()
+}
+
+// parseDataURL parses the URL of data to ingest, which must be http or https.
+func parseDataURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL %s: scheme must be http or https", redactBlobURL(u))
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %s: missing host", redactBlobURL(u))
+	}
+
+	return u, nil
+}
+
+// fetchURL gets u and returns the body of its response, which the caller must close.
+// A response other than 200 OK is returned as an error, with the start of its body.
+func fetchURL(ctx context.Context, cfg Config, u *url.URL, redacted string) (io.ReadCloser, error) {
+	client, err := httpClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{}
+	} else {
+		// Unlike Kusto's, data URLs may redirect, as to a CDN.
+		client.CheckRedirect = nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", redacted, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error quotes the URL, query included.
+		return nil, fmt.Errorf("error fetching %s: %w", redacted, redactURLError(err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		msg := strings.TrimSpace(string(snippet))
+		if msg == "" {
+			return nil, fmt.Errorf("error fetching %s: %s", redacted, resp.Status)
+		}
+		return nil, fmt.Errorf("error fetching %s: %s: %s", redacted, resp.Status, msg)
+	}
+
+	return resp.Body, nil
+}
+
+// redactURLError removes the URL from err if it is a *url.Error, keeping the error it wraps.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,125 @@
+package kustoclient
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIngestURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/data.csv":
+			w.Write([]byte("1,Sql,Isgood\n"))
+		case "/data.json":
+			w.Write([]byte(`{"a":1}` + "\n"))
+		case "/gzipped":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte("2,Sql,Isgood\n"))
+			gz.Close()
+		case "/data.csv.gz":
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte("3,Sql,Isgood\n"))
+			gz.Close()
+		case "/encoded.csv.gz":
+			// Decoded by the transport, the body is no longer gzipped.
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte("4,Sql,Isgood\n"))
+			gz.Close()
+		case "/data.json.zip", "/two.csv.zip":
+			zw := zip.NewWriter(w)
+			f, _ := zw.Create("data.json")
+			f.Write([]byte(`{"a":2}` + "\n"))
+			if r.URL.Path == "/two.csv.zip" {
+				f, _ = zw.Create("more.json")
+				f.Write([]byte(`{"a":3}` + "\n"))
+			}
+			zw.Close()
+		case "/redirect":
+			http.Redirect(w, r, "/data.csv", http.StatusFound)
+		default:
+			http.Error(w, "no such data", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		wantData    []string
+		wantOptions []string
+		wantErr     string
+	}{
+		{name: "csv", path: "/data.csv?sig=secret", wantData: []string{"1,Sql,Isgood\n"}, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{name: "format from the extension", path: "/data.json", wantData: []string{`{"a":1}` + "\n"}, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{name: "gzip encoded", path: "/gzipped", wantData: []string{"2,Sql,Isgood\n"}, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{name: "gzipped file", path: "/data.csv.gz", wantData: []string{"3,Sql,Isgood\n"}, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{name: "gzip encoded gzipped file", path: "/encoded.csv.gz", wantData: []string{"4,Sql,Isgood\n"}, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{name: "zipped file", path: "/data.json.zip", wantData: []string{`{"a":2}` + "\n"}, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{name: "zip of several files", path: "/two.csv.zip", wantErr: "zip archive holds 2 files"},
+		{name: "unsupported compression", path: "/data.csv.bz2", wantErr: "compressed with bzip2"},
+		{name: "redirect", path: "/redirect", wantData: []string{"1,Sql,Isgood\n"}, wantOptions: []string{"FileFormat", "FlushImmediately", "ReportResultToTable"}},
+		{name: "not found", path: "/missing?sig=secret", wantErr: "404 Not Found: no such data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingestor := &fakeIngestor{}
+			err := IngestURL(context.Background(), ingestor, testConfig(), server.URL+tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("IngestURL() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), "secret") {
+					t.Errorf("IngestURL() error = %v, want the query redacted", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IngestURL() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(ingestor.data, tt.wantData) {
+				t.Errorf("IngestURL() ingested %q, want %q", ingestor.data, tt.wantData)
+			}
+			if !reflect.DeepEqual(ingestor.options, [][]string{tt.wantOptions}) {
+				t.Errorf("IngestURL() options = %v, want %v", ingestor.options, tt.wantOptions)
+			}
+		})
+	}
+}
+
+func TestParseDataURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{url: "https://example.com/data.csv"},
+		{url: "http://example.com/data.csv?token=abc"},
+		{url: "ftp://example.com/data.csv", wantErr: "scheme must be http or https"},
+		{url: "data.csv", wantErr: "scheme must be http or https"},
+		{url: "https:///data.csv", wantErr: "missing host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := parseDataURL(tt.url)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("parseDataURL() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseDataURL() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
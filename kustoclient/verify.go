@@ -0,0 +1,76 @@
+package kustoclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-kusto-go/azkustodata"
+	"github.com/Azure/azure-kusto-go/azkustodata/kql"
+)
+
+const (
+	// DefaultVerifyWindow is how long Verify waits for ingested rows to show up when no window is configured.
+	DefaultVerifyWindow = 5 * time.Minute
+
+	// verifyPollInterval is how often Verify counts the ingested rows.
+	verifyPollInterval = 10 * time.Second
+)
+
+// Verify checks that rows ingested since the given time have landed in the configured table,
+// counting them every few seconds until there are some or window has passed. It catches
+// ingestions that were reported as successful but didn't add any rows.
+func Verify(ctx context.Context, client Querier, cfg Config, since time.Time, window time.Duration) (err error) {
+	defer func() { err = categorize(ErrIngest, err) }()
+
+	query := kql.New("table(tableName) | where ingestion_time() >= since | count")
+	params := kql.NewParameters().
+		AddString("tableName", cfg.Table).
+		AddDateTime("since", since)
+
+	deadline := time.Now().Add(window)
+	for {
+		count, err := countRows(ctx, client, cfg.IngestDB(), query, params)
+		if err != nil {
+			return fmt.Errorf("error verifying ingestion: %w", err)
+		}
+
+		if count > 0 {
+			logger.Info("Verified ingestion", "table", cfg.Table, "since", since, "newRows", count)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no rows ingested into table %s since %s showed up within %s", cfg.Table, since.Format(time.RFC3339), window)
+		}
+
+		logger.Info("No ingested rows yet, checking again", "table", cfg.Table, "delay", verifyPollInterval)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped verifying ingestion: %w", ctx.Err())
+		case <-time.After(verifyPollInterval):
+		}
+	}
+}
+
+// countRows runs a query ending in count and returns the count.
+func countRows(ctx context.Context, client Querier, database string, query *kql.Builder, params *kql.Parameters) (int64, error) {
+	rows, err := queryAll(ctx, client, database, query, azkustodata.QueryParameters(params))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rows) != 1 {
+		return 0, fmt.Errorf("count returned %d rows", len(rows))
+	}
+
+	count, err := rows[0].LongByIndex(0)
+	if err != nil {
+		return 0, fmt.Errorf("error reading count: %w", err)
+	}
+	if count == nil {
+		return 0, nil
+	}
+
+	return *count, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go-kusto-test/kustoclient"
+)
+
+// logger is used for all of the tool's output. It starts out as the default logger,
+// which writes plain-text lines through the standard log package, and is replaced
+// by setupLogger once the -log-format and -log-level flags have been parsed.
+var logger = slog.Default()
+
+// logLevels maps the -log-level values to the levels they print from.
+var logLevels = map[string]slog.Level{
+	"error": slog.LevelError,
+	"warn":  slog.LevelWarn,
+	"info":  slog.LevelInfo,
+	"debug": slog.LevelDebug,
+}
+
+// setupLogger configures logger, and the logger of the kustoclient package,
+// for the given log format, either "text" or "json", printing messages of the
+// given level and above.
+func setupLogger(format, level string) error {
+	minLevel, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		return fmt.Errorf("unsupported log level %q, supported levels are: error, warn, info, debug", level)
+	}
+
+	switch strings.ToLower(format) {
+	case "text":
+		slog.SetLogLoggerLevel(minLevel)
+		logger = slog.Default()
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: minLevel}))
+	default:
+		return fmt.Errorf("unsupported log format %q, supported formats are: text, json", format)
+	}
+
+	kustoclient.SetLogger(logger)
+	return nil
+}
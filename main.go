@@ -1,200 +1,910 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/Azure/azure-kusto-go/azkustodata"
-	"github.com/Azure/azure-kusto-go/azkustodata/kql"
-	"github.com/Azure/azure-kusto-go/azkustoingest"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"go-kusto-test/kustoclient"
 )
 
-const (
-	// KustoURL is the URL of the Kusto cluster.
-	KustoURL = "https://ravpateadx.eastus.kusto.windows.net"
-)
+func main() {
+	// Cancel the root context on the first SIGINT/SIGTERM so in-flight operations
+	// can unwind and close their clients. Once cancelled the handler is removed,
+	// so a second signal terminates the process immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			logger.Warn("Shutting down, send the signal again to force exit")
+		case <-done:
+		}
+	}()
 
-// AuthType is the authentication mechanism to use when
-// interacting with the Kusto cluster.
-type AuthType int
+	err := run(ctx)
+	close(done)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(exitCode(err))
+	}
+}
 
-const (
-	BearerToken AuthType = iota // Use a user's bearer token (will prompt for login)
-	Interactive                 // Uses your existing az login credentials (or prompts for login if needed)
-)
+// run parses the command line, then runs its command: connects to the cluster, ingests data
+// and queries it back, or does only part of that. It stops early when ctx is cancelled.
+func run(ctx context.Context) (err error) {
+	// Until the config is validated, a failure is an invalid flag or config.
+	code := exitConfig
+	defer func() { err = withExitCode(code, err) }()
+
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.Usage = func() { usage(nil) }
+
+	configPath := flag.String("config", "", "path of a YAML or JSON file setting cluster, database, table, auth, format and mapping (flags override it)")
+	clusterFlag := flag.String("cluster", kustoclient.DefaultKustoURL, "URL of the Kusto cluster (overridden by the KUSTO_URL environment variable)")
+	clustersFlag := flag.String("clusters", "", "comma-separated URLs of Kusto clusters to ingest the same data into, in turn, instead of -cluster")
+	database := flag.String("database", kustoclient.DefaultDatabase, "name of the Kusto database to ingest into and query")
+	ingestDatabase := flag.String("ingest-database", "", "name of the Kusto database to ingest into instead of -database")
+	queryDatabase := flag.String("query-database", "", "name of the Kusto database to query, and run -command and check against, instead of -database")
+	table := flag.String("table", kustoclient.DefaultTable, "name of the Kusto table to ingest into and query")
+	authFlag := flag.String("auth", "bearer", "how to authenticate: bearer (device code), interactive, sp, sp-cert, msi, cli, browser, workload or token")
+	tokenFile := flag.String("token", "", "path of a file holding the token for -auth token, instead of the KUSTO_TOKEN environment variable")
+	file := flag.String("file", "", "path of a file to ingest instead of the inline KQL row")
+	follow := flag.Bool("follow", false, "keep ingesting the lines appended to -file until interrupted, instead of ingesting it once")
+	followInterval := flag.Duration("follow-interval", kustoclient.DefaultFollowInterval, "how often -follow ingests the lines appended to -file")
+	followBatchSize := flag.Int("follow-batch-size", kustoclient.DefaultFollowBatchSize, "bytes of appended lines -follow buffers before ingesting them early")
+	dir := flag.String("dir", "", "path of a directory whose matching files are ingested instead of the inline KQL row")
+	pattern := flag.String("pattern", kustoclient.DefaultPattern, "glob pattern matched against file names in -dir")
+	recursive := flag.Bool("recursive", false, "also ingest matching files in subdirectories of -dir")
+	manifestPath := flag.String("manifest", "", "path of a CSV or JSON manifest listing files to ingest and the table each goes into, instead of the inline KQL row")
+	concurrency := flag.Int("concurrency", runtime.NumCPU(), "number of files in -dir, -manifest or -replay to ingest at once")
+	blob := flag.String("blob", "", "URL, with a SAS, of an Azure Storage blob for the cluster to ingest instead of the inline KQL row")
+	urlFlag := flag.String("url", "", "http or https URL of data to fetch and ingest instead of the inline KQL row")
+	blobSize := flag.Int64("blob-size", 0, "uncompressed size of -blob in bytes, if known")
+	creationTimeFlag := flag.String("creation-time", "", "RFC3339 time, such as 2024-06-01T00:00:00Z, to record as the creation time of the ingested data")
+	var tags stringsFlag
+	flag.Var(&tags, "tag", "ingest-by:<value> or drop-by:<value> tag to attach to the ingested data (repeatable)")
+	var props stringsFlag
+	flag.Var(&props, "prop", "key=value Kusto ingestion property to set, one of ignoreFirstRecord, validationPolicy or creationTime, others are ignored with a warning (repeatable)")
+	ingestByTag := flag.String("ingest-by-tag", "", "ingest-by: tag value identifying the ingested batch; with -if-not-exists, re-running with the same value doesn't ingest it again")
+	ifNotExists := flag.Bool("if-not-exists", false, "skip the ingestion if the table already has data with the -ingest-by-tag tag")
+	idempotency := flag.String("idempotency", "off", "auto, a key or off: tag each ingestion ingest-by:<key> and skip it if the table already has that tag, so retries and re-runs don't duplicate rows; auto derives each key from a hash of the data")
+	stdin := flag.Bool("stdin", false, "ingest data read from stdin instead of the inline KQL row")
+	replay := flag.String("replay", "", "path of a -dead-letter directory whose files are ingested again instead of the inline KQL row, removing each that is")
+	format := flag.String("format", "", "format of -file, -dir, -manifest, -blob, -url or -stdin: csv, tsv, psv, scsv, sohsv, json, multijson, parquet or avro (defaults to the file or URL extension, or detected from the data for -stdin and -url)")
+	flushImmediately := flag.Bool("flush-immediately", true, "have Kusto ingest queued data right away for the lowest latency; false lets it batch ingestions by the table's batching policy, which has higher throughput but takes minutes with the default policy")
+	keepSource := flag.Bool("keep-source", false, "keep the temp files data is ingested from, such as the inline ingest command, for inspecting what was ingested")
+	compress := flag.Bool("compress", false, "gzip -file, -dir or -manifest files before ingesting them (.gz and .zip files are always sent compressed)")
+	skipHeader := flag.Bool("skip-header", false, "skip the first record, such as a header row, of csv, tsv, psv, scsv or sohsv data ingested with -file, -dir, -manifest, -blob, -url or -stdin")
+	ignoreLastRecord := flag.Bool("ignore-last-record", false, "drop the last record, such as an incomplete one or a footer, of csv, tsv, psv, scsv or sohsv data ingested with -file, -dir, -manifest, -url or -stdin")
+	mapping := flag.String("mapping", "", "name of a pre-created ingestion mapping to use with -file, -dir, -manifest, -blob, -url or -stdin")
+	mappingJSON := flag.String("mapping-json", "", "ingestion mapping to use with -file, -dir, -manifest, -blob, -url or -stdin, given inline as a JSON array of column mappings")
+	maxRetries := flag.Int("max-retries", kustoclient.DefaultMaxRetries, "number of times a transiently failing ingestion is retried")
+	retryFailed := flag.Bool("retry-failed", false, "ingest again, up to -max-retries times, data that Kusto reports as failed transiently")
+	deadLetter := flag.String("dead-letter", "", "path of a directory to copy each -file, -dir or -manifest file that fails to ingest into, with a .err file holding the reason, for -replay")
+	limit := flag.Int("limit", kustoclient.DefaultLimit, "number of rows to query back from the table")
+	columns := flag.String("columns", "", "comma-separated list of the columns to query back, instead of all of them")
+	since := flag.Duration("since", 0, "only query back rows whose Timestamp is within this long of now, such as 1h")
+	fromFlag := flag.String("from", "", "RFC3339 time, such as 2024-06-01T00:00:00Z, of the earliest Timestamp to query back")
+	toFlag := flag.String("to", "", "RFC3339 time of the latest Timestamp to query back")
+	pageSize := flag.Int("page-size", kustoclient.DefaultPageSize, "number of queried rows to write out at a time, bounding memory use for large results")
+	ingestModeFlag := flag.String("ingest-mode", "queued", "ingestion client to use: queued, streaming (low latency) or managed (streaming with queued fallback)")
+	command := flag.String("command", "", "management command to run, such as \".show table T schema\", instead of querying back the table")
+	count := flag.Bool("count", false, "print the number of rows in the table instead of querying back the last rows")
+	serverTimeout := flag.Duration("server-timeout", 0, "how long the cluster may run the query back before cancelling it (defaults to -query-timeout or -timeout)")
+	requestID := flag.String("request-id", "", "client request ID to send the query back with, to find it in .show queries (generated when empty)")
+	iterative := flag.Bool("iterative", true, "stream query results; -iterative=false fetches them in a single request instead")
+	outputFlag := flag.String("output", "log", "how to write query results: log, json (one object per line on stdout) or csv (on stdout)")
+	raw := flag.Bool("raw", false, "for debugging, write every table the query returns, including its completion information, and the full status record of failed ingestions, as JSON lines on stdout")
+	outputPath := flag.String("output-file", "", "path of a file to write -output json or csv query results, or -raw output, to instead of stdout, replacing its contents")
+	var scopes stringsFlag
+	flag.Var(&scopes, "scope", "token scope to request instead of <cluster>/.default, such as for a national cloud (repeatable)")
+	cloudFlag := flag.String("cloud", "public", "Azure cloud the cluster is in: public, usgov or china")
+	proxy := flag.String("proxy", "", "http or https URL of a proxy to connect to the cluster and AAD through")
+	caCert := flag.String("ca-cert", "", "path of a PEM file of CA certificates to trust in addition to the system's, such as a proxy's")
+	appNameFlag := flag.String("app-name", appName, "application name requests identify themselves as, listed by .show queries and .show commands")
+	appVersion := flag.String("app-version", version, "application version requests identify themselves as, alongside -app-name")
+	noCache := flag.Bool("no-cache", false, "prompt for a new token instead of reusing a cached one")
+	pollInterval := flag.Duration("poll-interval", kustoclient.DefaultPollInterval, "how long to wait for a queued ingestion before reporting it as pending, doubling for each later report (reports are left out when stderr isn't a terminal)")
+	maxPollInterval := flag.Duration("max-poll-interval", kustoclient.DefaultMaxPollInterval, "longest wait between reports of a pending ingestion")
+	verify := flag.Bool("verify", false, "after ingesting, check that new rows show up in the table")
+	verifyWindow := flag.Duration("verify-window", kustoclient.DefaultVerifyWindow, "how long -verify waits for new rows to show up")
+	timeout := flag.Duration("timeout", defaultTimeout, "time limit for each of authenticating, ingesting and querying")
+	queryTimeout := flag.Duration("query-timeout", 0, "time limit for querying back the table, instead of -timeout, such as for heavy queries")
+	shutdownTimeout := flag.Duration("shutdown-timeout", defaultShutdownTimeout, "how long to wait for submitted ingestions to complete after an interrupt or -timeout")
+	noPreflight := flag.Bool("no-preflight", false, "skip checking that the table exists before ingesting, and that the queried columns do before querying")
+	createTable := flag.Bool("create-table", false, "create the table with -schema before ingesting, if it doesn't exist")
+	schemaFlag := flag.String("schema", "", "columns of the table -create-table creates, such as Timestamp:datetime,FirstName:string,LastName:string")
+	yes := flag.Bool("yes", false, "ingest without asking for confirmation (required when stdin isn't a terminal)")
+	benchRows := flag.Int("bench-rows", kustoclient.DefaultBenchRows, "number of generated rows each iteration of the benchmark ingests")
+	benchIterations := flag.Int("bench-iterations", kustoclient.DefaultBenchIterations, "number of times to run the benchmark, reporting the fastest, slowest and mean")
+	ping := flag.Bool("ping", false, "check with a print query, which needs no table, and print its result, instead of with a management command")
+	dryRun := flag.Bool("dry-run", false, "log the ingest command and options without ingesting anything")
+	metricsAddr := flag.String("metrics-addr", "", "address, such as :9090, to serve Prometheus metrics on at /metrics (disabled when empty)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP endpoint, such as localhost:4318, to export traces to (disabled when empty)")
+	logFormat := flag.String("log-format", "text", "format of log output: text or json")
+	logLevel := flag.String("log-level", "info", "least severe log messages to print: error, warn, info or debug")
+	verbose := flag.Bool("v", false, "print debug log messages, as -log-level debug does")
+	reportFlag := flag.String("report", "", "at the end of the run, write a summary of it: json for a single JSON object (disabled when empty)")
+	reportFile := flag.String("report-file", "", "path of a file to write the -report summary to instead of stdout")
+	cmd, err := parseCommandLine(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
 
-// String returns the string representation of the AuthType.
-func (a AuthType) String() string {
-	switch a {
-	case BearerToken:
-		return "BearerToken"
-	case Interactive:
-		return "Interactive"
-	default:
-		return "Unknown"
+	if cmd.name == "version" {
+		output, err := kustoclient.ParseOutputFormat(*outputFlag)
+		if err != nil {
+			return err
+		}
+		return printVersion(os.Stdout, output == kustoclient.JSONOutput)
 	}
-}
 
-func main() {
-	authType := BearerToken
-	log.Println("Auth type: ", authType.String())
+	if *verbose {
+		if isFlagSet("log-level") {
+			return fmt.Errorf("-v and -log-level can't be used together")
+		}
+		*logLevel = "debug"
+	}
 
-	// Prepare clients
-	kcsb, err := getKustoConnStr(authType)
+	if err := setupLogger(*logFormat, *logLevel); err != nil {
+		return err
+	}
+
+	if *configPath != "" {
+		fc, err := loadConfigFile(*configPath)
+		if err != nil {
+			return err
+		}
+
+		applyConfigFile(map[string]fileValue{
+			"cluster":  {clusterFlag, fc.Cluster},
+			"database": {database, fc.Database},
+			"table":    {table, fc.Table},
+			"format":   {format, fc.Format},
+			"mapping":  {mapping, fc.Mapping},
+			"auth":     {authFlag, fc.Auth},
+		})
+
+		if len(fc.Clusters) > 0 && !isFlagSet("clusters") {
+			*clustersFlag = strings.Join(fc.Clusters, ",")
+		}
+	}
+
+	authType, err := kustoclient.ParseAuthType(*authFlag)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if *tokenFile != "" && authType != kustoclient.StaticToken {
+		return fmt.Errorf("-token requires -auth token")
 	}
 
-	client, err := getKustoClient(kcsb)
+	clusters, err := parseClusters(*clustersFlag)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if len(clusters) > 0 && (isFlagSet("cluster") || os.Getenv("KUSTO_URL") != "") {
+		return fmt.Errorf("-clusters can't be used together with -cluster or the KUSTO_URL environment variable")
 	}
 
-	defer client.Close()
+	if *limit <= 0 {
+		return fmt.Errorf("invalid -limit %d: must be a positive integer", *limit)
+	}
 
-	// Pass down connection string to ingest client and ingest data
-	log.Println("Ingesting data...")
-	if err := ingestData(kcsb); err != nil {
-		panic(err)
+	if *pageSize <= 0 {
+		return fmt.Errorf("invalid -page-size %d: must be a positive integer", *pageSize)
 	}
 
-	// Pass down kusto client to data client and get data
-	log.Println("Getting data...")
-	if err := getData(client); err != nil {
-		panic(err)
+	if *concurrency <= 0 {
+		return fmt.Errorf("invalid -concurrency %d: must be a positive integer", *concurrency)
 	}
 
-	log.Println("Done.")
-}
+	if *verifyWindow <= 0 {
+		return fmt.Errorf("invalid -verify-window %s: must be positive", *verifyWindow)
+	}
 
-// getAzBearerToken gets a bearer token from Azure Active Directory.
-func getAzBearerToken() (*azcore.AccessToken, error) {
-	cred, err := azidentity.NewDeviceCodeCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to obtain a credential: %v", err)
+	if *pollInterval <= 0 {
+		return fmt.Errorf("invalid -poll-interval %s: must be positive", *pollInterval)
 	}
 
-	token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{
-		Scopes: []string{fmt.Sprintf("%s/.default", KustoURL)},
-	})
+	if *maxPollInterval <= 0 {
+		return fmt.Errorf("invalid -max-poll-interval %s: must be positive", *maxPollInterval)
+	}
+
+	if *timeout <= 0 {
+		return fmt.Errorf("invalid -timeout %s: must be positive", *timeout)
+	}
+
+	if *queryTimeout < 0 {
+		return fmt.Errorf("invalid -query-timeout %s: must not be negative", *queryTimeout)
+	}
+
+	if *shutdownTimeout < 0 {
+		return fmt.Errorf("invalid -shutdown-timeout %s: must not be negative", *shutdownTimeout)
+	}
+
+	sources := 0
+	for _, set := range []bool{*stdin, *file != "", *dir != "", *manifestPath != "", *blob != "", *urlFlag != "", *replay != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of -stdin, -file, -dir, -manifest, -blob, -url and -replay can be used")
+	}
+
+	if *deadLetter != "" {
+		if *file == "" && *dir == "" && *manifestPath == "" {
+			return fmt.Errorf("-dead-letter can only be used with -file, -dir or -manifest")
+		}
+		if *follow {
+			return fmt.Errorf("-dead-letter and -follow can't be used together, -follow ingests appended lines, not the file")
+		}
+	}
+	// Replayed files are removed once ingested, which leaves none for the other clusters.
+	if *replay != "" && len(clusters) > 0 {
+		return fmt.Errorf("-replay and -clusters can't be used together")
+	}
+
+	if *follow {
+		if *file == "" {
+			return fmt.Errorf("-follow can only be used with -file")
+		}
+		if *followInterval <= 0 {
+			return fmt.Errorf("invalid -follow-interval %s: must be positive", *followInterval)
+		}
+		if *followBatchSize <= 0 {
+			return fmt.Errorf("invalid -follow-batch-size %d: must be a positive integer", *followBatchSize)
+		}
+		if len(clusters) > 0 {
+			return fmt.Errorf("-follow and -clusters can't be used together")
+		}
+	}
+
+	if *benchRows <= 0 {
+		return fmt.Errorf("invalid -bench-rows %d: must be a positive integer", *benchRows)
+	}
+	if *benchIterations <= 0 {
+		return fmt.Errorf("invalid -bench-iterations %d: must be a positive integer", *benchIterations)
+	}
+
+	if *blobSize < 0 {
+		return fmt.Errorf("invalid -blob-size %d: must not be negative", *blobSize)
+	}
+
+	ingestMode, err := kustoclient.ParseIngestMode(*ingestModeFlag)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get a token: %v", err)
+		return err
 	}
 
-	return &token, nil
-}
+	if *command != "" && *count {
+		return fmt.Errorf("-command and -count can't be used together")
+	}
 
-// getKustoConnStr gets a connection string for Kusto using the given auth type.
-func getKustoConnStr(authType AuthType) (*azkustodata.ConnectionStringBuilder, error) {
+	if *reportFlag != "" && *reportFlag != "json" {
+		return fmt.Errorf("unsupported -report %q, the supported report is: json", *reportFlag)
+	}
+	if *reportFile != "" && *reportFlag == "" {
+		return fmt.Errorf("-report-file can only be used with -report")
+	}
 
-	switch authType {
-	case BearerToken:
-		accessToken, err := getAzBearerToken()
-		if err != nil {
-			return nil, err
+	if *command != "" || *count {
+		replacing := "-command"
+		if *count {
+			replacing = "-count"
+		}
+
+		// These only shape the data query, which -command and -count replace.
+		for _, conflict := range []string{"limit", "iterative"} {
+			if isFlagSet(conflict) {
+				return fmt.Errorf("%s and -%s can't be used together", replacing, conflict)
+			}
+		}
+	}
+
+	if *ifNotExists && *ingestByTag == "" {
+		return fmt.Errorf("-if-not-exists requires -ingest-by-tag")
+	}
+
+	var ingestIfNotExists string
+	if *ingestByTag != "" {
+		if tag := kustoclient.IngestByPrefix + *ingestByTag; !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+		if *ifNotExists {
+			ingestIfNotExists = *ingestByTag
 		}
+	}
 
-		return azkustodata.NewConnectionStringBuilder(KustoURL).WitAadUserToken(accessToken.Token), nil
-	case Interactive:
-		return azkustodata.NewConnectionStringBuilder(KustoURL).WithDefaultAzureCredential(), nil
+	var idempotencyKey string
+	switch *idempotency {
+	case "off", "":
+	case kustoclient.AutoIdempotencyKey:
+		idempotencyKey = kustoclient.AutoIdempotencyKey
 	default:
-		return nil, fmt.Errorf("invalid auth type: " + fmt.Sprint(authType))
+		// Every file or batch would be tagged alike, and all but the first skipped.
+		if *dir != "" || *manifestPath != "" || *follow || *replay != "" {
+			return fmt.Errorf("-idempotency with a key can't be used with -dir, -manifest, -follow or -replay, use -idempotency auto instead")
+		}
+		idempotencyKey = *idempotency
+	}
+	if idempotencyKey != "" && (*ingestByTag != "" || *ifNotExists) {
+		return fmt.Errorf("-idempotency and -ingest-by-tag or -if-not-exists can't be used together")
+	}
+
+	creationTime, err := parseTimeFlag("creation-time", *creationTimeFlag)
+	if err != nil {
+		return err
+	}
+
+	var properties map[string]string
+	for _, prop := range props {
+		key, value, err := kustoclient.ParseProperty(prop)
+		if err != nil {
+			return fmt.Errorf("invalid -prop: %w", err)
+		}
+		if _, ok := properties[key]; ok {
+			return fmt.Errorf("invalid -prop: ingestion property %q is set more than once", key)
+		}
+		if properties == nil {
+			properties = map[string]string{}
+		}
+		properties[key] = value
+	}
+
+	var schema []kustoclient.TableColumn
+	if *createTable {
+		if *schemaFlag == "" {
+			return fmt.Errorf("-create-table requires -schema")
+		}
+		schema, err = kustoclient.ParseSchema(*schemaFlag)
+		if err != nil {
+			return err
+		}
+	} else if *schemaFlag != "" {
+		return fmt.Errorf("-schema can only be used with -create-table")
 	}
-}
 
-// getKustoClient gets a Kusto client using the given connection string builder.
-func getKustoClient(kcsb *azkustodata.ConnectionStringBuilder) (*azkustodata.Client, error) {
-	client, err := azkustodata.New(kcsb)
+	if *since != 0 && (*fromFlag != "" || *toFlag != "") {
+		return fmt.Errorf("-since can't be combined with -from or -to")
+	}
 
+	from, err := parseTimeFlag("from", *fromFlag)
 	if err != nil {
-		return nil, fmt.Errorf("error creating kusto client: %w", err)
+		return err
 	}
 
-	return client, nil
-}
+	to, err := parseTimeFlag("to", *toFlag)
+	if err != nil {
+		return err
+	}
+
+	output, err := kustoclient.ParseOutputFormat(*outputFlag)
+	if err != nil {
+		return err
+	}
 
-// ingestData ingests data into the ravpateTable of the ArcSqlTelemetry database.
-func ingestData(kcsb *azkustodata.ConnectionStringBuilder) error {
-	ctx := context.Background()
-	ingestor, err := azkustoingest.New(kcsb, azkustoingest.WithDefaultDatabase("ArcSqlTelemetry"), azkustoingest.WithDefaultTable("ravpateTable"))
+	if *raw {
+		// Raw queries are run in a single request and written as JSON, whatever the output.
+		for _, name := range []string{"output", "iterative"} {
+			if isFlagSet(name) {
+				return fmt.Errorf("-raw and -%s can't be used together", name)
+			}
+		}
+	} else if *outputPath != "" && output == kustoclient.LogOutput {
+		return fmt.Errorf("-output-file requires -output json or csv, or -raw")
+	}
 
+	cloud, err := kustoclient.ParseCloud(*cloudFlag)
 	if err != nil {
-		return fmt.Errorf("error creating ingestor: %w", err)
+		return err
 	}
 
-	// Don't forget to close the ingestor when you're done.
-	defer ingestor.Close()
+	if *mapping != "" && sources == 0 {
+		return fmt.Errorf("-mapping can only be used with -file, -dir, -manifest, -blob, -url or -stdin")
+	}
+	if *mappingJSON != "" && sources == 0 {
+		return fmt.Errorf("-mapping-json can only be used with -file, -dir, -manifest, -blob, -url or -stdin")
+	}
+	if *ignoreLastRecord && (sources == 0 || *blob != "") {
+		return fmt.Errorf("-ignore-last-record can only be used with -file, -dir, -manifest, -url or -stdin")
+	}
+	if *ignoreLastRecord && *follow {
+		return fmt.Errorf("-ignore-last-record and -follow can't be used together, -follow only ingests complete lines")
+	}
+	if *mapping != "" && *mappingJSON != "" {
+		return fmt.Errorf("-mapping and -mapping-json can't be used together")
+	}
 
-	// Add a row to the ingestor.
-	currentTime := time.Now().UTC()
+	var manifest []kustoclient.ManifestEntry
+	if *manifestPath != "" {
+		// -create-table and -verify work on -table, which the manifest's files may not go into.
+		if *createTable || *verify {
+			return fmt.Errorf("-manifest can't be used with -create-table or -verify")
+		}
+		manifest, err = kustoclient.ReadManifest(*manifestPath)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Kusto Cluster has the following:
-	// - ArcSqlTelemetry database name
-	// - ravpateTable table name
-	// - ravpateTable has: Timestamp, FirstName, LastName as columns
-	// Getting the current time and ingesting that into the table to test we have gotten it.
-	ingestQuery := fmt.Sprintf(`.ingest inline into table ravpateTable <| %s,Sql,Isgood`,
-		currentTime.Format(time.RFC3339))
+	cfg := kustoclient.Config{
+		ClusterURL:         resolveKustoURL(*clusterFlag),
+		Database:           *database,
+		IngestDatabase:     *ingestDatabase,
+		QueryDatabase:      *queryDatabase,
+		Table:              *table,
+		AuthType:           authType,
+		Cloud:              cloud,
+		ProxyURL:           *proxy,
+		CACertFile:         *caCert,
+		NoTokenCache:       *noCache,
+		TokenFile:          *tokenFile,
+		AppName:            *appNameFlag,
+		AppVersion:         *appVersion,
+		Scopes:             scopes,
+		Format:             *format,
+		Compress:           *compress,
+		Mapping:            *mapping,
+		MappingJSON:        *mappingJSON,
+		KeepSource:         *keepSource,
+		NoFlushImmediately: !*flushImmediately,
+		SkipHeader:         *skipHeader,
+		IgnoreLastRecord:   *ignoreLastRecord,
+		MaxRetries:         *maxRetries,
+		RetryFailed:        *retryFailed,
+		Concurrency:        *concurrency,
+		DeadLetterDir:      *deadLetter,
+		Limit:              *limit,
+		Columns:            splitList(*columns),
+		Since:              *since,
+		From:               from,
+		To:                 to,
+		PageSize:           *pageSize,
+		ServerTimeout:      *serverTimeout,
+		RequestID:          *requestID,
+		IngestMode:         ingestMode,
+		Output:             output,
+		NonIterative:       !*iterative,
+		Raw:                *raw,
+		PollInterval:       *pollInterval,
+		MaxPollInterval:    *maxPollInterval,
+		CreationTime:       creationTime,
+		Tags:               tags,
+		IngestIfNotExists:  ingestIfNotExists,
+		IdempotencyKey:     idempotencyKey,
+		Properties:         properties,
+		DryRun:             *dryRun,
+		// Pending reports are for someone watching the run, not for logs captured to a file.
+		NoProgress: !isTerminal(os.Stderr),
+	}
 
-	log.Println("Writing ingest query to ingest.kql...")
-	log.Println("\t", ingestQuery)
-	os.WriteFile("ingest.kql", []byte(ingestQuery), 0644)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
 
-	log.Println("Running ingest query now...")
+	for _, key := range kustoclient.UnknownProperties(cfg.Properties) {
+		logger.Warn("Ignoring ingestion property that can't be set", "property", key, "value", cfg.Properties[key])
+	}
 
-	ingestOptions := []azkustoingest.FileOption{
-		azkustoingest.DeleteSource(),
-		azkustoingest.FlushImmediately(),
-		azkustoingest.ReportResultToTable(),
+	for _, cluster := range clusters {
+		clusterCfg := cfg
+		clusterCfg.ClusterURL = cluster
+		if err := clusterCfg.Validate(); err != nil {
+			return fmt.Errorf("invalid -clusters: %w", err)
+		}
+	}
+	code = exitFailure
+
+	// The rows of inline ingestions, the only ones whose rows are counted.
+	var rowsIngested *int64
+	if *reportFlag != "" {
+		start := time.Now()
+		defer func() {
+			report := newRunReport(cfg, clusters, start, rowsIngested, withExitCode(code, err))
+			if reportErr := writeReport(*reportFile, report); reportErr != nil {
+				err = errors.Join(err, reportErr)
+			}
+		}()
 	}
 
-	status, err := ingestor.FromFile(ctx, "./ingest.kql", ingestOptions...)
+	ctx, shutdownTracing, err := setupTracing(ctx, *otlpEndpoint)
 	if err != nil {
-		return fmt.Errorf("error ingesting data: %w", err)
+		return err
 	}
+	defer func() {
+		// The run's context may be cancelled already, give the exporter its own time to flush.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("Failed to export traces", "error", err)
+		}
+	}()
 
-	err = <-status.Wait(ctx)
-	if err != nil {
-		return fmt.Errorf("error waiting for ingest: %w", err)
+	if *metricsAddr != "" {
+		stopMetrics, err := startMetricsServer(*metricsAddr)
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+	}
+
+	// The clusters the run works against.
+	targets := clusters
+	if len(targets) == 0 {
+		targets = []string{cfg.ClusterURL}
+	}
+
+	if cmd.name == "check" {
+		return withExitCode(exitAuth, checkClusters(ctx, os.Stdout, cfg, targets, *timeout, *ping))
+	}
+
+	if (cmd.name == "ingest" || cmd.name == "bench") && !*yes && !cfg.DryRun {
+		if *stdin || !isTerminal(os.Stdin) {
+			return fmt.Errorf("stdin isn't a terminal to confirm ingestion on, pass -yes to ingest without confirmation")
+		}
+
+		ok, err := confirmIngestion(os.Stdin, os.Stderr, targets, cfg.IngestDB(), cfg.Table)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("ingestion not confirmed")
+		}
+	}
+
+	if cmd.name == "bench" {
+		return withExitCode(exitIngest, benchClusters(ctx, os.Stdout, cfg, targets, *timeout, *benchRows, *benchIterations))
+	}
+
+	if *outputPath != "" {
+		out, err := createOutputFile(*outputPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := out.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}()
+		cfg.Out = out
+	}
+
+	var stdinData []byte
+	if *stdin {
+		// Stdin can only be read once, buffer it for every cluster.
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("error reading stdin: %w", err)
+		}
+		stdinData = data
 	}
 
+	p := pipeline{
+		ingest: func(ctx context.Context, ingestor kustoclient.Ingestor, cfg kustoclient.Config) error {
+			switch {
+			case *stdin:
+				return kustoclient.IngestReader(ctx, ingestor, cfg, bytes.NewReader(stdinData))
+			case *follow:
+				return kustoclient.Follow(ctx, ingestor, cfg, *file, *followInterval, *followBatchSize)
+			case *file != "":
+				return kustoclient.IngestFile(ctx, ingestor, cfg, *file)
+			case *blob != "":
+				return kustoclient.IngestBlob(ctx, ingestor, cfg, *blob, *blobSize)
+			case *urlFlag != "":
+				return kustoclient.IngestURL(ctx, ingestor, cfg, *urlFlag)
+			case *dir != "":
+				return kustoclient.IngestDirectory(ctx, ingestor, cfg, *dir, *pattern, *recursive)
+			case len(manifest) > 0:
+				return kustoclient.IngestManifest(ctx, ingestor, cfg, manifest)
+			case *replay != "":
+				return kustoclient.Replay(ctx, ingestor, cfg, *replay)
+			default:
+				rows, err := kustoclient.Ingest(ctx, ingestor, cfg)
+				if err != nil {
+					return err
+				}
+				if rows == kustoclient.UnknownRowCount {
+					logger.Info("Ingested rows", "table", cfg.Table, "rows", "unknown")
+				} else {
+					logger.Info("Ingested rows", "table", cfg.Table, "rows", rows)
+					rowsIngested = addRows(rowsIngested, rows)
+				}
+				return nil
+			}
+		},
+		follow:          *follow,
+		timeout:         *timeout,
+		queryTimeout:    *queryTimeout,
+		shutdownTimeout: *shutdownTimeout,
+		createTable:     schema,
+		preflight:       !*noPreflight,
+		tables:          kustoclient.ManifestTables(manifest),
+		verify:          *verify,
+		verifyWindow:    *verifyWindow,
+		command:         *command,
+		count:           *count,
+	}
+
+	if cmd.name == "query" {
+		p.ingest = nil
+	}
+
+	if len(clusters) > 0 {
+		return runClusters(ctx, p, cfg, clusters)
+	}
+
+	if err := p.run(ctx, cfg); err != nil {
+		return err
+	}
+
+	logger.Info("Done.")
 	return nil
 }
 
-// getData gets the last 5 rows from the ravpateTable of the ArcSqlTelemetry database.
-func getData(client *azkustodata.Client) error {
-	ctx := context.Background()
-	dataset, err := client.IterativeQuery(ctx, "ArcSqlTelemetry", kql.New("ravpateTable | order by Timestamp desc | take 5"))
+// pipeline is what run does against each cluster: connect, check the table exists,
+// ingest, verify, then query the table back or run a command. The query command skips
+// straight to querying.
+type pipeline struct {
+	// ingest ingests the data selected on the command line with ingestor. With none, the
+	// pipeline starts at querying the table.
+	ingest func(ctx context.Context, ingestor kustoclient.Ingestor, cfg kustoclient.Config) error
+
+	// follow makes ingest run until ctx is done, with no timeout, and ends the pipeline after it.
+	follow bool
+
+	timeout time.Duration
+
+	// queryTimeout, if set, is the time limit for querying back the table instead of timeout.
+	queryTimeout time.Duration
+
+	// createTable, if set, are the columns to create the table with before ingesting.
+	createTable []kustoclient.TableColumn
+	preflight   bool
+
+	// tables, if set, are the tables ingested into instead of the configured one, which the
+	// preflight checks.
+	tables []string
+
+	// shutdownTimeout is how long to wait for pending ingestions when ingesting is interrupted.
+	shutdownTimeout time.Duration
+
+	verify       bool
+	verifyWindow time.Duration
+	command      string
+	count        bool
+}
+
+// run runs the pipeline against the cluster in cfg, closing its clients before returning.
+func (p pipeline) run(ctx context.Context, cfg kustoclient.Config) (err error) {
+	logger.Info("Starting", "authType", cfg.AuthType.String(), "cloud", cfg.Cloud.String(), "cluster", cfg.ClusterURL, "ingestDatabase", cfg.IngestDB(), "queryDatabase", cfg.QueryDB(), "table", cfg.Table, "ingestMode", cfg.IngestMode.String())
+
+	// Prepare clients
+	var kusto *kustoclient.Client
+	err = withTimeout(ctx, p.timeout, "authentication", func(ctx context.Context) error {
+		var err error
+		kusto, err = kustoclient.NewClient(ctx, cfg)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("error querying dataset: %w", err)
+		return withExitCode(exitAuth, err)
+	}
+
+	defer kusto.Close()
+
+	client, ingestor := kusto.Querier(), kusto.Ingestor()
+
+	// Before the ingestor is closed, wait for any ingestions an interruption or timeout
+	// stopped us waiting for, so the run doesn't end looking successful while they're pending.
+	defer func() {
+		waitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.shutdownTimeout)
+		defer cancel()
+		if pendingErr := kustoclient.WaitPending(waitCtx); pendingErr != nil {
+			err = errors.Join(err, withExitCode(exitIngest, pendingErr))
+		}
+	}()
+
+	if p.ingest != nil {
+		if err := p.runIngest(ctx, client, ingestor, cfg); err != nil || p.follow {
+			return err
+		}
+	}
+
+	if p.command != "" {
+		logger.Info("Running command...", "database", cfg.QueryDB(), "command", p.command)
+		err = withTimeout(ctx, p.timeout, "command", func(ctx context.Context) error {
+			return kustoclient.Command(ctx, client, cfg, p.command)
+		})
+		if err != nil {
+			return withExitCode(exitQuery, err)
+		}
+	} else if p.count {
+		logger.Info("Counting rows...", "database", cfg.QueryDB(), "table", cfg.Table)
+		err = withTimeout(ctx, p.timeout, "count", func(ctx context.Context) error {
+			return kustoclient.Count(ctx, client, cfg)
+		})
+		if err != nil {
+			return withExitCode(exitQuery, err)
+		}
+	} else {
+		if p.preflight {
+			logger.Info("Checking queried columns exist...", "database", cfg.QueryDB(), "table", cfg.Table, "columns", cfg.Columns)
+			err = withTimeout(ctx, p.timeout, "preflight check", func(ctx context.Context) error {
+				return kustoclient.CheckColumns(ctx, client, cfg)
+			})
+			if err != nil {
+				return withExitCode(exitQuery, err)
+			}
+		}
+
+		// Pass down kusto client to data client and get data
+		logger.Info("Getting data...", "database", cfg.QueryDB(), "table", cfg.Table)
+		queryTimeout := p.timeout
+		if p.queryTimeout > 0 {
+			queryTimeout = p.queryTimeout
+		}
+		err = withTimeout(ctx, queryTimeout, "query", func(ctx context.Context) error {
+			return kustoclient.Query(ctx, client, cfg)
+		})
+		if err != nil {
+			return withExitCode(exitQuery, err)
+		}
 	}
 
-	// Don't forget to close the dataset when you're done.
-	defer dataset.Close()
+	return nil
+}
+
+// runIngest creates the table and checks it exists as configured, then ingests into it and
+// verifies the ingestion, with the clients of the cluster in cfg.
+func (p pipeline) runIngest(ctx context.Context, client kustoclient.Querier, ingestor kustoclient.Ingestor, cfg kustoclient.Config) error {
+	if len(p.createTable) > 0 && !cfg.DryRun {
+		err := withTimeout(ctx, p.timeout, "table creation", func(ctx context.Context) error {
+			return kustoclient.CreateTable(ctx, client, cfg, p.createTable)
+		})
+		if err != nil {
+			return withExitCode(exitIngest, err)
+		}
+	}
 
-	primaryResult := <-dataset.Tables() // The first table in the dataset will be the primary results.
+	if p.preflight {
+		tables := p.tables
+		if len(tables) == 0 {
+			tables = []string{cfg.Table}
+		}
+		for _, table := range tables {
+			tableCfg := cfg
+			tableCfg.Table = table
+			logger.Info("Checking table exists...", "database", cfg.IngestDB(), "table", table)
+			err := withTimeout(ctx, p.timeout, "preflight check", func(ctx context.Context) error {
+				return kustoclient.CheckTable(ctx, client, tableCfg)
+			})
+			if err != nil {
+				return withExitCode(exitIngest, err)
+			}
+		}
+	}
 
-	// Make sure to check for errors.
-	if primaryResult.Err() != nil {
-		return fmt.Errorf("error getting primary result: %w", primaryResult.Err())
+	// Pass down ingest client and ingest data
+	logger.Info("Ingesting data...", "database", cfg.IngestDB(), "table", cfg.Table)
+	ingestStart := time.Now()
+	if p.follow {
+		return withExitCode(exitIngest, p.ingest(ctx, ingestor, cfg))
+	}
+	err := withTimeout(ctx, p.timeout, "ingestion", func(ctx context.Context) error {
+		return p.ingest(ctx, ingestor, cfg)
+	})
+	if err != nil {
+		return withExitCode(exitIngest, err)
 	}
 
-	log.Println("Results:")
-	log.Println()
-	for rowResult := range primaryResult.Table().Rows() {
-		if rowResult.Err() != nil {
-			return fmt.Errorf("error getting row result: %w", rowResult.Err())
+	if p.verify && !cfg.DryRun {
+		logger.Info("Verifying ingestion...", "database", cfg.IngestDB(), "table", cfg.Table)
+		err = withTimeout(ctx, p.verifyWindow+p.timeout, "verification", func(ctx context.Context) error {
+			return kustoclient.Verify(ctx, client, cfg, ingestStart, p.verifyWindow)
+		})
+		if err != nil {
+			return withExitCode(exitIngest, err)
 		}
-		row := rowResult.Row()
+	}
+
+	return nil
+}
+
+// defaultTimeout is the default time limit for each operation.
+const defaultTimeout = 5 * time.Minute
 
-		log.Println(row)
+// defaultShutdownTimeout is how long pending ingestions are waited for by default when
+// ingesting is interrupted.
+const defaultShutdownTimeout = 30 * time.Second
+
+// withTimeout runs the named operation with a context that expires after timeout.
+// If it fails because it ran out of time, the error says which operation timed out
+// and wraps context.DeadlineExceeded.
+func withTimeout(ctx context.Context, timeout time.Duration, operation string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wrapCanceled(ctx, fn(ctx))
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s: %w", operation, timeout, err)
 	}
 
+	return err
+}
+
+// wrapCanceled makes sure an error caused by ctx being cancelled wraps ctx.Err(),
+// since errors coming back from the SDK don't always preserve it.
+func wrapCanceled(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %v", ctx.Err(), err)
+}
+
+// stringsFlag is a flag.Value collecting the values of a flag given more than once.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
 	return nil
 }
+
+// parseTimeFlag parses the value of the named RFC3339 time flag, returning the zero time if it's empty.
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s %q: must be an RFC3339 time such as 2024-06-01T00:00:00Z", name, value)
+	}
+
+	return t, nil
+}
+
+// splitList splits a comma-separated list, trimming spaces and dropping empty entries.
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// resolveKustoURL picks the cluster URL from the KUSTO_URL environment variable,
+// falling back to the given flag value and then the default cluster.
+func resolveKustoURL(flagValue string) string {
+	kustoURL := os.Getenv("KUSTO_URL")
+	if kustoURL == "" {
+		kustoURL = flagValue
+	}
+	if kustoURL == "" {
+		kustoURL = kustoclient.DefaultKustoURL
+	}
+
+	return strings.TrimRight(kustoURL, "/")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// outputFile is a file query results are written to, buffered.
+type outputFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+// createOutputFile creates the file at path for query results, truncating it if it exists.
+func createOutputFile(path string) (*outputFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %w", err)
+	}
+
+	return &outputFile{Writer: bufio.NewWriter(f), file: f}, nil
+}
+
+// Close flushes the buffered results to the file and closes it.
+func (o *outputFile) Close() error {
+	if err := errors.Join(o.Flush(), o.file.Close()); err != nil {
+		return fmt.Errorf("error writing output file %q: %w", o.file.Name(), err)
+	}
+
+	return nil
+}
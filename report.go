@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go-kusto-test/kustoclient"
+)
+
+// runReport is the summary of a run written by -report json, as a single JSON object.
+type runReport struct {
+	AuthType string `json:"auth_type"`
+
+	// Cluster is the cluster of the run, or when -clusters is used, Clusters are.
+	Cluster  string   `json:"cluster,omitempty"`
+	Clusters []string `json:"clusters,omitempty"`
+
+	Database string `json:"database"`
+	Table    string `json:"table"`
+
+	// FilesIngested is the number of ingestions that completed: one per file, or for the
+	// inline row, stdin, a blob or a URL.
+	FilesIngested int64 `json:"files_ingested"`
+
+	// RowsIngested is null when the number of rows isn't known, as for files, whose rows
+	// Kusto doesn't report.
+	RowsIngested *int64 `json:"rows_ingested"`
+
+	QueryRows       int64   `json:"query_rows"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Success         bool    `json:"success"`
+	ExitCode        int     `json:"exit_code"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// newRunReport sums up the run against cfg and clusters that started at start and ended
+// with err, and ingested rowsIngested rows if those are known.
+func newRunReport(cfg kustoclient.Config, clusters []string, start time.Time, rowsIngested *int64, err error) runReport {
+	stats := kustoclient.ReadStats()
+	report := runReport{
+		AuthType:        cfg.AuthType.String(),
+		Cluster:         cfg.ClusterURL,
+		Clusters:        clusters,
+		Database:        cfg.Database,
+		Table:           cfg.Table,
+		FilesIngested:   stats.Ingestions,
+		RowsIngested:    rowsIngested,
+		QueryRows:       stats.QueryRows,
+		DurationSeconds: time.Since(start).Seconds(),
+		Success:         err == nil,
+		ExitCode:        exitOK,
+	}
+	if len(clusters) > 0 {
+		report.Cluster = ""
+	}
+
+	if err != nil {
+		report.ExitCode = exitCode(err)
+		report.Error = err.Error()
+	}
+
+	return report
+}
+
+// writeReport writes report as a line of JSON to the file at path, or to stdout when path is empty.
+func writeReport(path string, report runReport) error {
+	if path == "" {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating report file: %w", err)
+	}
+
+	if err := json.NewEncoder(f).Encode(report); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing report file %q: %w", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing report file %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// addRows adds rows to the count of rows ingested so far, which is nil before any are.
+func addRows(count *int64, rows int64) *int64 {
+	if count != nil {
+		rows += *count
+	}
+
+	return &rows
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// setupTracing exports the kustoclient spans over OTLP/HTTP to endpoint, either a URL or a
+// host:port, which is assumed to be plain http. With no endpoint the spans aren't recorded.
+// The returned ctx carries the trace context from the TRACEPARENT and TRACESTATE environment
+// variables, if set, so that the run joins the caller's trace. The returned func flushes
+// any buffered spans and shuts the exporter down.
+func setupTracing(ctx context.Context, endpoint string) (context.Context, func(context.Context) error, error) {
+	propagator := propagation.TraceContext{}
+	otel.SetTextMapPropagator(propagator)
+	ctx = propagator.Extract(ctx, propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	})
+
+	if endpoint == "" {
+		return ctx, func(context.Context) error { return nil }, nil
+	}
+
+	opt := otlptracehttp.WithEndpointURL(endpoint)
+	if !strings.Contains(endpoint, "://") {
+		opt = otlptracehttp.WithEndpointURL("http://" + endpoint)
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("go-kusto-test")))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return ctx, provider.Shutdown, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"go-kusto-test/kustoclient"
+)
+
+// command is a verb of the command line, selecting what a run does.
+type command struct {
+	name    string
+	summary string
+
+	// groups are the titles of the flagGroups the command takes besides the shared ones,
+	// and flags any other flags it takes.
+	groups []string
+	flags  []string
+}
+
+// commands are the commands of the command line, in the order the usage message lists them.
+var commands = []command{
+	{name: "ingest", summary: "ingest data into the table, then query the table back", groups: []string{"What to ingest (the inline KQL row when none is given)", "Ingestion", "Querying"}},
+	{name: "query", summary: "query the table, or run a management command, without ingesting", groups: []string{"Querying"}},
+	{name: "check", summary: "check that the cluster can be authenticated to and reached, without ingesting or querying", groups: []string{"Checking"}},
+	{name: "bench", summary: "ingest generated rows several times over and report how fast they were ingested", groups: []string{"Ingestion", "Benchmarking"}},
+	{name: "version", summary: "print the version of the tool, Go and the Kusto SDK", flags: []string{"output"}},
+}
+
+// lookupCommand returns the command called name, or nil if there is none.
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
+
+// flagGroups lists the flags in the order the usage message shows them in. Shared flags
+// can be given before the command as well as after it, and each command takes the other
+// groups it lists.
+var flagGroups = []struct {
+	title  string
+	shared bool
+	flags  []string
+}{
+	{"Connection", true, []string{"config", "cluster", "clusters", "database", "ingest-database", "query-database", "table", "auth", "token", "scope", "cloud", "proxy", "ca-cert", "app-name", "app-version", "no-cache", "timeout"}},
+	{"What to ingest (the inline KQL row when none is given)", false, []string{"file", "follow", "follow-interval", "follow-batch-size", "dir", "pattern", "recursive", "manifest", "concurrency", "blob", "blob-size", "url", "stdin", "replay"}},
+	{"Ingestion", false, []string{"format", "compress", "keep-source", "skip-header", "ignore-last-record", "mapping", "mapping-json", "ingest-mode", "flush-immediately", "creation-time", "tag", "ingest-by-tag", "prop", "if-not-exists", "idempotency", "max-retries", "retry-failed", "dead-letter", "poll-interval", "max-poll-interval", "shutdown-timeout", "create-table", "schema", "no-preflight", "verify", "verify-window", "yes", "dry-run"}},
+	{"Querying", false, []string{"limit", "columns", "since", "from", "to", "page-size", "iterative", "query-timeout", "server-timeout", "request-id", "command", "count", "output", "raw", "output-file", "no-preflight"}},
+	{"Checking", false, []string{"ping"}},
+	{"Benchmarking", false, []string{"bench-rows", "bench-iterations"}},
+	{"Logging and reporting", true, []string{"metrics-addr", "otlp-endpoint", "log-format", "log-level", "v", "report", "report-file"}},
+}
+
+// takesGroup reports whether cmd takes the flags of the group titled title. With no
+// command, only the shared groups are taken.
+func (cmd *command) takesGroup(title string, shared bool) bool {
+	return shared || (cmd != nil && slices.Contains(cmd.groups, title))
+}
+
+// flagNames returns the names of the flags cmd takes, in usage order.
+func (cmd *command) flagNames() []string {
+	var names []string
+	for _, group := range flagGroups {
+		if cmd.takesGroup(group.title, group.shared) {
+			names = append(names, group.flags...)
+		}
+	}
+	if cmd != nil {
+		names = append(names, cmd.flags...)
+	}
+
+	return names
+}
+
+// cmdFlags are the flag sets the command line was parsed with: the shared flags given before
+// the command, then the command's own.
+var cmdFlags []*flag.FlagSet
+
+// newFlagSet returns a flag set for cmd, or the shared flags when cmd is nil, made of flags
+// defined on flag.CommandLine. The flags share their values with flag.CommandLine's, so
+// parsing sets the variables the flags were defined with.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	name := os.Args[0]
+	if cmd != nil {
+		name += " " + cmd.name
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(flag.CommandLine.Output())
+	fs.Usage = func() { usage(cmd) }
+
+	seen := map[string]bool{}
+	for _, name := range cmd.flagNames() {
+		if f := flag.Lookup(name); f != nil && !seen[name] {
+			fs.Var(f.Value, f.Name, f.Usage)
+			seen[name] = true
+		}
+	}
+
+	return fs
+}
+
+// parseCommandLine parses args as shared flags, a command and the command's flags, and returns
+// the command. Without any arguments, or given help, it prints the usage message and returns
+// flag.ErrHelp, as it does for -h.
+func parseCommandLine(args []string) (*command, error) {
+	shared := newFlagSet(nil)
+	if err := shared.Parse(args); err != nil {
+		return nil, err
+	}
+	cmdFlags = []*flag.FlagSet{shared}
+
+	commandNames := make([]string, len(commands))
+	for i, cmd := range commands {
+		commandNames[i] = cmd.name
+	}
+
+	switch {
+	case len(args) == 0 || shared.Arg(0) == "help":
+		usage(nil)
+		return nil, flag.ErrHelp
+	case shared.NArg() == 0:
+		return nil, fmt.Errorf("missing command, the commands are: %s", strings.Join(commandNames, ", "))
+	}
+
+	cmd := lookupCommand(shared.Arg(0))
+	if cmd == nil {
+		return nil, fmt.Errorf("unknown command %q, the commands are: %s", shared.Arg(0), strings.Join(commandNames, ", "))
+	}
+
+	fs := newFlagSet(cmd)
+	if err := fs.Parse(shared.Args()[1:]); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q, %s only takes flags", fs.Arg(0), cmd.name)
+	}
+	cmdFlags = append(cmdFlags, fs)
+
+	return cmd, nil
+}
+
+// usage prints what cmd does and its flags by group, or with cmd nil, the commands and the
+// shared flags. It goes on with the -auth and -format values and the exit codes.
+func usage(cmd *command) {
+	out := flag.CommandLine.Output()
+	if cmd == nil {
+		fmt.Fprintf(out, "Usage: %s [flags] <command> [command flags]\n", os.Args[0])
+		fmt.Fprintln(out, "Ingests data into a Kusto table and queries the table back.")
+		fmt.Fprintln(out, "\nCommands:")
+		for _, c := range commands {
+			fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+		}
+		fmt.Fprintf(out, "\nRun %s <command> -h for the flags of a command.\n", os.Args[0])
+	} else {
+		fmt.Fprintf(out, "Usage: %s [flags] %s [flags]\n", os.Args[0], cmd.name)
+		fmt.Fprintf(out, "%s%s.\n", strings.ToUpper(cmd.summary[:1]), cmd.summary[1:])
+	}
+
+	printed := map[string]bool{}
+	for _, group := range flagGroups {
+		if !cmd.takesGroup(group.title, group.shared) {
+			continue
+		}
+
+		fmt.Fprintf(out, "\n%s:\n", group.title)
+		for _, name := range group.flags {
+			if f := flag.Lookup(name); f != nil && !printed[name] {
+				printFlag(out, f)
+				printed[name] = true
+			}
+		}
+	}
+	if cmd != nil && len(cmd.flags) > 0 {
+		fmt.Fprintln(out, "\nFlags:")
+		for _, name := range cmd.flags {
+			if f := flag.Lookup(name); f != nil {
+				printFlag(out, f)
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "\n-auth values:")
+	for _, a := range kustoclient.AuthTypes() {
+		name := strings.ToLower(a.String())
+		if alias := a.Alias(); alias != "" {
+			name = alias + ", " + name
+		}
+		fmt.Fprintf(out, "  %-32s %s\n", name, a.Description())
+	}
+
+	if cmd != nil && cmd.name == "ingest" {
+		fmt.Fprintf(out, "\n-format values:\n  %s\n  (delimited: %s)\n", strings.Join(kustoclient.SupportedFormats(), ", "), strings.Join(kustoclient.DelimitedFormats(), ", "))
+	}
+
+	fmt.Fprint(out, exitCodesHelp)
+}
+
+// printFlag prints a flag the way flag.PrintDefaults does, with its default unless it is the
+// zero value.
+func printFlag(out io.Writer, f *flag.Flag) {
+	name, usage := flag.UnquoteUsage(f)
+	line := "  -" + f.Name
+	if name != "" {
+		line += " " + name
+	}
+	line += "\n    \t" + strings.ReplaceAll(usage, "\n", "\n    \t")
+
+	switch f.DefValue {
+	case "", "false", "0", "0s":
+	default:
+		if name == "string" {
+			line += fmt.Sprintf(" (default %q)", f.DefValue)
+		} else {
+			line += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+	}
+
+	fmt.Fprintln(out, line)
+}
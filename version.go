@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is the version of the tool, set at build time with
+// -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// appName is the name requests identify the tool as by default, set with -app-name.
+const appName = "go-kusto-test"
+
+// kustoModules are the azure-kusto-go modules whose versions are reported by the version command.
+var kustoModules = []string{
+	"github.com/Azure/azure-kusto-go/azkustodata",
+	"github.com/Azure/azure-kusto-go/azkustoingest",
+}
+
+// versionInfo describes the running build.
+type versionInfo struct {
+	Version   string            `json:"version"`
+	GoVersion string            `json:"goVersion"`
+	Modules   map[string]string `json:"modules"`
+}
+
+// buildVersion returns the version of the tool, the Go runtime it was built with, and the
+// versions of the azure-kusto-go modules it was built against, as recorded in its build info.
+func buildVersion() versionInfo {
+	info := versionInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Modules:   map[string]string{},
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, dep := range build.Deps {
+		for _, name := range kustoModules {
+			if dep.Path == name {
+				info.Modules[name] = dep.Version
+			}
+		}
+	}
+
+	return info
+}
+
+// printVersion writes the build's versions to w, as JSON when jsonOutput is set
+// and otherwise as one line each.
+func printVersion(w io.Writer, jsonOutput bool) error {
+	info := buildVersion()
+	if jsonOutput {
+		return json.NewEncoder(w).Encode(info)
+	}
+
+	if _, err := fmt.Fprintf(w, "go-kusto-test %s\ngo %s\n", info.Version, info.GoVersion); err != nil {
+		return err
+	}
+	for _, name := range kustoModules {
+		modVersion, ok := info.Modules[name]
+		if !ok {
+			modVersion = "unknown"
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", name, modVersion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}